@@ -1,6 +1,8 @@
 package env
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
 )
@@ -18,6 +20,8 @@ type E struct {
 	DBDialect string `env:"DIALECT_DB" envDefault:"sqlite3"`                   // sqlite3 or postgres
 	DBURL     string `env:"DB_URL" envDefault:"file:data.db?_foreign_keys=on"` // "postgres://<user>:<pass>@<host>:<port>/<DB>?sslmode=disable
 
+	InstanceStore string `env:"INSTANCE_STORE" envDefault:"redis"` // redis or sql (same database as DB_URL)
+
 	GCSEnabled bool   `env:"GCS_ENABLED" envDefault:"false"`
 	GCSBucket  string `env:"GCS_BUCKET" envDefault:"whatsmiau"`
 	GCSURL     string `env:"GCS_URL" envDefault:"https://storage.googleapis.com"`
@@ -28,6 +32,40 @@ type E struct {
 
 	EmitterBufferSize    int `env:"EMITTER_BUFFER_SIZE" envDefault:"2048"`
 	HandlerSemaphoreSize int `env:"HANDLER_SEMAPHORE_SIZE" envDefault:"512"`
+
+	WebhookMaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"10"`
+	WebhookRetryBase   time.Duration `env:"WEBHOOK_RETRY_BASE" envDefault:"5s"`
+	WebhookRetryMax    time.Duration `env:"WEBHOOK_RETRY_MAX" envDefault:"30m"`
+	WebhookWorkers     int           `env:"WEBHOOK_WORKERS" envDefault:"4"`      // concurrent requests per destination url
+	WebhookQueueSize   int           `env:"WEBHOOK_QUEUE_SIZE" envDefault:"256"` // pending deliveries per worker
+	WebhookTimeout     time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"30s"`
+
+	EventStreamBuffer int `env:"EVENT_STREAM_BUFFER" envDefault:"1024"` // events kept to resume websocket streams
+
+	ReconnectBase        time.Duration `env:"RECONNECT_BASE" envDefault:"2s"`
+	ReconnectMax         time.Duration `env:"RECONNECT_MAX" envDefault:"5m"`
+	ReconnectMaxAttempts int           `env:"RECONNECT_MAX_ATTEMPTS" envDefault:"0"` // 0 retries forever
+
+	PresenceRefresh time.Duration `env:"PRESENCE_REFRESH" envDefault:"5m"` // how often AlwaysOnline instances announce themselves
+	PresenceIdle    time.Duration `env:"PRESENCE_IDLE" envDefault:"10s"`   // idle time after a send before going unavailable
+
+	SendRate             float64 `env:"SEND_RATE" envDefault:"60"`              // messages per minute per instance, 0 disables
+	SendBurst            int     `env:"SEND_BURST" envDefault:"20"`             // messages an instance can send at once
+	SendRecipientRate    float64 `env:"SEND_RECIPIENT_RATE" envDefault:"20"`    // messages per minute to the same recipient, 0 disables
+	SendRecipientBurst   int     `env:"SEND_RECIPIENT_BURST" envDefault:"5"`    // messages to the same recipient at once
+	SendDailyNewContacts int     `env:"SEND_DAILY_NEW_CONTACTS" envDefault:"0"` // numbers not in the contacts messaged per day, 0 disables
+
+	SendQueueSize    int           `env:"SEND_QUEUE_SIZE" envDefault:"1000"`  // pending async sends per instance
+	SendJobRetention time.Duration `env:"SEND_JOB_RETENTION" envDefault:"1h"` // how long finished send jobs can be looked up
+
+	LinkPreviewTimeout  time.Duration `env:"LINK_PREVIEW_TIMEOUT" envDefault:"5s"`        // to fetch a link preview, page and image
+	LinkPreviewMaxBytes int64         `env:"LINK_PREVIEW_MAX_BYTES" envDefault:"1048576"` // largest page or image fetched for a link preview
+
+	StickerMaxBytes int64 `env:"STICKER_MAX_BYTES" envDefault:"10485760"` // largest image or animation converted to a sticker
+
+	ScheduleMaxDelay time.Duration `env:"SCHEDULE_MAX_DELAY" envDefault:"24h"` // how late a scheduled message can still be sent after its instance was offline
+
+	UnmatchedDevices string `env:"UNMATCHED_DEVICES" envDefault:"quarantine"` // quarantine or logout devices without instance at startup
 }
 
 var Env E
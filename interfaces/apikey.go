@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+type ApiKeyRepository interface {
+	Create(ctx context.Context, key *models.ApiKey) error
+	Get(ctx context.Context, id string) (*models.ApiKey, error)
+	List(ctx context.Context, instanceID string) ([]models.ApiKey, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByInstance(ctx context.Context, instanceID string) error
+}
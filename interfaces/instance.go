@@ -8,6 +8,7 @@ import (
 type InstanceRepository interface {
 	Create(ctx context.Context, instance *models.Instance) error
 	List(ctx context.Context, id string) ([]models.Instance, error)
-	Update(ctx context.Context, id string, instance *models.Instance) (*models.Instance, error)
+	Search(ctx context.Context, filter *models.InstanceFilter) (*models.InstancePage, error)
+	Update(ctx context.Context, id string, update *models.InstanceUpdate) (*models.Instance, error)
 	Delete(ctx context.Context, id string) error
 }
@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+type ScheduleRepository interface {
+	// Create stores the message and, while it is pending, queues it for SendAt.
+	Create(ctx context.Context, message *models.ScheduledMessage) error
+	// Update stores the message, queueing it again for SendAt while it is
+	// pending and removing it from the queue otherwise.
+	Update(ctx context.Context, message *models.ScheduledMessage) error
+	// Claim returns pending messages due at now, hiding them from other claims for lease.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]models.ScheduledMessage, error)
+	// ExtendLease pushes the claim of a message to until, unless it left the
+	// queue or is already due later, as after a reschedule.
+	ExtendLease(ctx context.Context, id string, until time.Time) error
+	Get(ctx context.Context, id string) (*models.ScheduledMessage, error)
+	// List returns the messages of an instance ordered by SendAt.
+	List(ctx context.Context, instanceID string) ([]models.ScheduledMessage, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByInstance(ctx context.Context, instanceID string) error
+}
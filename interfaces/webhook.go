@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+type WebhookRepository interface {
+	// Schedule stores the delivery and queues it to be attempted at NextAttemptAt.
+	Schedule(ctx context.Context, delivery *models.WebhookDelivery) error
+	// Claim returns deliveries due at now, hiding them from other claims for lease.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]models.WebhookDelivery, error)
+	// DeadLetter stores the delivery and removes it from the queue.
+	DeadLetter(ctx context.Context, delivery *models.WebhookDelivery) error
+	// Done removes a delivered delivery.
+	Done(ctx context.Context, delivery *models.WebhookDelivery) error
+	Delete(ctx context.Context, delivery *models.WebhookDelivery) error
+	Get(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	List(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+}
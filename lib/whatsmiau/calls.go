@@ -0,0 +1,119 @@
+package whatsmiau
+
+import (
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	callStatusOffer     = "offer"
+	callStatusAccept    = "accept"
+	callStatusTerminate = "terminate"
+	callStatusReject    = "reject"
+)
+
+func (s *Whatsmiau) handleCallEvent(id string, instance *models.Instance, evt any, eventMap map[string]bool) {
+	var (
+		meta    types.BasicCallMeta
+		data    = &WookCallData{}
+		isOffer bool
+	)
+
+	switch e := evt.(type) {
+	case *events.CallOffer:
+		meta, isOffer = e.BasicCallMeta, true
+		data.Status = callStatusOffer
+		data.IsVideo, data.IsGroup = callKind(e.Data)
+	case *events.CallOfferNotice:
+		meta, isOffer = e.BasicCallMeta, true
+		data.Status = callStatusOffer
+		data.IsVideo = e.Media == "video"
+		data.IsGroup = e.Type == "group"
+	case *events.CallAccept:
+		meta = e.BasicCallMeta
+		data.Status = callStatusAccept
+		data.IsVideo, data.IsGroup = callKind(e.Data)
+	case *events.CallTerminate:
+		meta = e.BasicCallMeta
+		data.Status = callStatusTerminate
+		data.Reason = e.Reason
+	case *events.CallReject:
+		meta = e.BasicCallMeta
+		data.Status = callStatusReject
+	default:
+		return
+	}
+
+	caller := meta.CallCreator
+	if caller.IsEmpty() {
+		caller = meta.From
+	}
+
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+
+	data.Id = meta.CallID
+	data.Date = meta.Timestamp
+	data.ChatId, data.ChatLid = s.GetJidLid(ctx, id, meta.From)
+	data.From, data.FromLid = s.GetJidLid(ctx, id, caller)
+	data.InstanceId = instance.ID
+
+	if isOffer && instance.RejectCall {
+		data.AutoRejected = s.rejectCall(ctx, id, instance, meta.From, caller, meta.CallID)
+	}
+
+	if !eventMap[WookCall.Name()] {
+		return
+	}
+
+	s.emit(instance, &WookEvent[WookCallData]{
+		Instance: instance.ID,
+		Data:     data,
+		DateTime: time.Now(),
+		Event:    WookCall,
+	})
+}
+
+// rejectCall declines the call and answers the caller with MsgCall, if set.
+func (s *Whatsmiau) rejectCall(ctx context.Context, id string, instance *models.Instance, from, caller types.JID, callID string) bool {
+	client, ok := s.clients.Load(id)
+	if !ok {
+		return false
+	}
+
+	if err := client.RejectCall(from, callID); err != nil {
+		zap.L().Error("failed to reject call", zap.String("instance", id), zap.String("call", callID), zap.Error(err))
+		return false
+	}
+
+	if len(instance.MsgCall) == 0 {
+		return true
+	}
+
+	if _, err := client.SendMessage(ctx, caller.ToNonAD(), &waE2E.Message{
+		Conversation: proto.String(instance.MsgCall),
+	}); err != nil {
+		zap.L().Error("failed to send call reply", zap.String("instance", id), zap.String("call", callID), zap.Error(err))
+	}
+
+	return true
+}
+
+// callKind reads whether an offer or accept node is a video and a group call.
+func callKind(node *waBinary.Node) (isVideo bool, isGroup bool) {
+	if node == nil {
+		return false, false
+	}
+
+	_, isVideo = node.GetOptionalChildByTag("video")
+	_, isGroup = node.Attrs["group-jid"]
+	return isVideo, isGroup
+}
@@ -42,6 +42,7 @@ func (s *Whatsmiau) ChatPresence(data *ChatPresenceRequest) error {
 		return whatsmeow.ErrClientIsNil
 	}
 
+	s.touchPresence(data.InstanceID)
 	return client.SendChatPresence(*data.RemoteJID, data.Presence, data.Media)
 }
 
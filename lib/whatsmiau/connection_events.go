@@ -0,0 +1,127 @@
+package whatsmiau
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+)
+
+// Evolution (Baileys) status reasons sent in connection.update
+const (
+	statusReasonOpen               = 200
+	statusReasonLoggedOut          = 401
+	statusReasonForbidden          = 403
+	statusReasonConnectionClosed   = 428
+	statusReasonConnectionReplaced = 440
+)
+
+const (
+	connectionStateOpen       = "open"
+	connectionStateConnecting = "connecting"
+	connectionStateClose      = "close"
+)
+
+func (s *Whatsmiau) handleConnectionEvent(id string, instance *models.Instance, evt any, eventMap map[string]bool) {
+	if !eventMap[WookConnectionUpdate.Name()] {
+		return
+	}
+
+	data := &WookConnectionUpdateData{
+		Instance: instance.ID,
+	}
+	if client, ok := s.clients.Load(id); ok && client.Store.ID != nil {
+		data.Wuid = client.Store.ID.ToNonAD().String()
+	}
+
+	switch e := evt.(type) {
+	case *events.Connected:
+		data.State = connectionStateOpen
+		data.StatusReason = statusReasonOpen
+	case *events.Disconnected:
+		// whatsmeow reconnects on its own after a dropped socket
+		data.State = connectionStateConnecting
+		data.StatusReason = statusReasonConnectionClosed
+		data.Reason = "disconnected"
+	case *events.LoggedOut:
+		data.State = connectionStateClose
+		data.StatusReason = statusReasonLoggedOut
+		data.Reason = "logged out: " + e.Reason.String()
+	case *events.StreamReplaced:
+		data.State = connectionStateClose
+		data.StatusReason = statusReasonConnectionReplaced
+		data.Reason = "stream replaced by another connection"
+	case *events.TemporaryBan:
+		data.State = connectionStateClose
+		data.StatusReason = statusReasonForbidden
+		data.Reason = "temporary ban: " + e.String()
+		data.BanExpire = int(e.Expire.Seconds())
+	case *events.ConnectFailure:
+		data.State = connectionStateClose
+		data.StatusReason = int(e.Reason)
+		data.Reason = e.Reason.String()
+		if len(e.Message) > 0 {
+			data.Reason += ": " + e.Message
+		}
+	default:
+		return
+	}
+
+	if data.State == connectionStateClose {
+		zap.L().Warn("instance connection closed",
+			zap.String("instance", id),
+			zap.Int("status_reason", data.StatusReason),
+			zap.String("reason", data.Reason),
+		)
+	}
+
+	s.emit(instance, &WookEvent[WookConnectionUpdateData]{
+		Instance: instance.ID,
+		Data:     data,
+		DateTime: time.Now(),
+		Event:    WookConnectionUpdate,
+	})
+}
+
+// emitQrCodeUpdated sends qrcode.updated for a new QR code or pairing code.
+func (s *Whatsmiau) emitQrCodeUpdated(id, code, pairingCode string) {
+	instance := s.getInstanceCached(id)
+	if instance == nil {
+		return
+	}
+
+	enabled := false
+	for _, event := range instance.Webhook.Events {
+		if event == WookQrCodeUpdated.Name() {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return
+	}
+
+	qr := WookQrCode{
+		Instance:    instance.ID,
+		Code:        code,
+		PairingCode: pairingCode,
+	}
+	if len(code) > 0 {
+		png, err := qrcode.Encode(code, qrcode.Medium, 256)
+		if err != nil {
+			zap.L().Error("failed to encode qrcode", zap.Error(err))
+		} else {
+			qr.Base64 = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		}
+	}
+
+	s.emit(instance, &WookEvent[WookQrCodeUpdatedData]{
+		Instance: instance.ID,
+		Data:     &WookQrCodeUpdatedData{QrCode: qr},
+		DateTime: time.Now(),
+		Event:    WookQrCodeUpdated,
+	})
+}
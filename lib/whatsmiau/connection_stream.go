@@ -0,0 +1,129 @@
+package whatsmiau
+
+import (
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+type ConnectionEventType string
+
+const (
+	ConnectionEventQrCode      ConnectionEventType = "qrcode"
+	ConnectionEventPairingCode ConnectionEventType = "pairing-code"
+	ConnectionEventOpen        ConnectionEventType = "open"
+	ConnectionEventClosed      ConnectionEventType = "closed"
+)
+
+// ConnectionEvent is a step of the login of an instance: a new QR code or
+// pairing code, and finally the open or closed state.
+type ConnectionEvent struct {
+	Type        ConnectionEventType `json:"type"`
+	Code        string              `json:"code,omitempty"`
+	PairingCode string              `json:"pairingCode,omitempty"`
+	RemoteJID   string              `json:"remoteJid,omitempty"`
+	Reason      string              `json:"reason,omitempty"`
+	DateTime    time.Time           `json:"dateTime"`
+}
+
+// Final reports whether no more events follow for this login attempt.
+func (e *ConnectionEvent) Final() bool {
+	return e.Type == ConnectionEventOpen || e.Type == ConnectionEventClosed
+}
+
+// connectionHub keeps the watchers of each instance login and the last code
+// shown, so a watcher arriving mid-login gets the current code right away.
+type connectionHub struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan ConnectionEvent]struct{}
+	last     map[string]ConnectionEvent
+}
+
+func newConnectionHub() *connectionHub {
+	return &connectionHub{
+		watchers: make(map[string]map[chan ConnectionEvent]struct{}),
+		last:     make(map[string]ConnectionEvent),
+	}
+}
+
+func (h *connectionHub) publish(id string, event ConnectionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	event.DateTime = time.Now()
+	if event.Final() {
+		delete(h.last, id)
+	} else {
+		h.last[id] = event
+	}
+
+	for watcher := range h.watchers[id] {
+		select {
+		case watcher <- event:
+		default:
+			// codes rotate, a watcher that missed one gets the next
+		}
+	}
+}
+
+func (h *connectionHub) watch(id string) (chan ConnectionEvent, *ConnectionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	watcher := make(chan ConnectionEvent, 8)
+	if _, ok := h.watchers[id]; !ok {
+		h.watchers[id] = make(map[chan ConnectionEvent]struct{})
+	}
+	h.watchers[id][watcher] = struct{}{}
+
+	if last, ok := h.last[id]; ok {
+		return watcher, &last
+	}
+
+	return watcher, nil
+}
+
+func (h *connectionHub) unwatch(id string, watcher chan ConnectionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.watchers[id], watcher)
+	if len(h.watchers[id]) == 0 {
+		delete(h.watchers, id)
+	}
+}
+
+// WatchConnection follows the login of an instance. If it is already logged
+// in an open event is returned right away; otherwise the QR code flow is
+// started unless a login (QR or pairing code) is already in progress. The
+// returned func must be called to stop watching.
+func (s *Whatsmiau) WatchConnection(id string) (<-chan ConnectionEvent, *ConnectionEvent, func()) {
+	watcher, current := s.connections.watch(id)
+	stop := func() { s.connections.unwatch(id, watcher) }
+
+	client, ok := s.clients.Load(id)
+	if ok && client.IsLoggedIn() {
+		return watcher, &ConnectionEvent{
+			Type:      ConnectionEventOpen,
+			RemoteJID: client.Store.ID.String(),
+			DateTime:  time.Now(),
+		}, stop
+	}
+
+	if current != nil {
+		return watcher, current, stop
+	}
+
+	_, observing := s.observerRunning.Load(id)
+	_, pairing := s.pairingObserver.Load(id)
+	if !observing && !pairing {
+		if !ok {
+			client = whatsmeow.NewClient(s.container.NewDevice(), s.logger)
+			s.clients.Store(id, client)
+		}
+		go s.observeConnection(client, id)
+	}
+
+	return watcher, nil, stop
+}
@@ -9,4 +9,6 @@ const (
 	Pairing        = "pairing"
 	PairingPending = "pairing-pending"
 	Closed         = "closed"
+	Backoff        = "backoff" // waiting to reconnect
+	Failed         = "failed"  // gave up reconnecting, needs a restart or a new login
 )
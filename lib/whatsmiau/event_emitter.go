@@ -1,12 +1,10 @@
 package whatsmiau
 
 import (
-	"bytes"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -27,10 +25,24 @@ type emitter struct {
 	data any
 }
 
+// getInstanceCached is loadInstanceCached for callers that can go on without
+// the instance, failures are only logged.
 func (s *Whatsmiau) getInstanceCached(id string) *models.Instance {
+	instance, err := s.loadInstanceCached(id)
+	if err != nil {
+		zap.L().Error("failed to get instanceCached by instance", zap.String("instance", id), zap.Error(err))
+		return nil
+	}
+
+	return instance
+}
+
+// loadInstanceCached returns the instance, nil when it does not exist, caching
+// it for 10 seconds.
+func (s *Whatsmiau) loadInstanceCached(id string) (*models.Instance, error) {
 	instanceCached, ok := s.instanceCache.Load(id)
 	if ok {
-		return &instanceCached
+		return &instanceCached, nil
 	}
 
 	ctx, c := context.WithTimeout(context.Background(), time.Second*5)
@@ -38,12 +50,12 @@ func (s *Whatsmiau) getInstanceCached(id string) *models.Instance {
 
 	res, err := s.repo.List(ctx, id)
 	if err != nil {
-		zap.L().Panic("failed to get instanceCached by instance", zap.Error(err))
+		return nil, err
 	}
 
 	if len(res) == 0 {
 		zap.L().Warn("no instanceCached found by instance", zap.String("instance", id))
-		return nil
+		return nil, nil
 	}
 
 	s.instanceCache.Store(id, res[0])
@@ -53,48 +65,99 @@ func (s *Whatsmiau) getInstanceCached(id string) *models.Instance {
 		s.instanceCache.Delete(id)
 	}()
 
-	return &res[0]
+	return &res[0], nil
+}
+
+// ReloadInstance drops the cached settings of an instance after it changed, so
+// the next event already uses them, and applies its presence settings.
+func (s *Whatsmiau) ReloadInstance(id string) {
+	s.instanceCache.Delete(id)
+
+	client, ok := s.clients.Load(id)
+	if !ok || !client.IsLoggedIn() {
+		return
+	}
+
+	instance := s.getInstanceCached(id)
+	if instance == nil {
+		s.stopPresence(id)
+		return
+	}
+
+	if instance.AlwaysOnline {
+		s.startPresenceRefresh(id)
+		return
+	}
+
+	if state, ok := s.presences.Load(id); ok {
+		state.mu.Lock()
+		refreshing := state.refresh != nil
+		state.mu.Unlock()
+		if refreshing {
+			s.stopPresence(id)
+			s.setPresence(id, types.PresenceUnavailable)
+		}
+	}
 }
 
 func (s *Whatsmiau) startEmitter() {
 	for event := range s.emitter {
-		data, err := json.Marshal(event.data)
-		if err != nil {
-			zap.L().Error("failed to marshal event", zap.Error(err))
-			return
+		if len(event.url) == 0 {
+			continue
 		}
 
-		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, event.url, bytes.NewReader(data))
+		delivery, err := s.newDelivery(event)
 		if err != nil {
-			zap.L().Error("failed to create request", zap.Error(err))
-			return
+			zap.L().Error("failed to create webhook delivery", zap.Error(err), zap.String("url", event.url))
+			continue
 		}
 
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := s.httpClient.Do(req)
-		if err != nil {
-			zap.L().Error("failed to send request", zap.Error(err))
-			return
-		}
-		defer resp.Body.Close()
+		s.dispatchDelivery(delivery)
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			res, err := io.ReadAll(resp.Body)
-			if err != nil {
-				zap.L().Error("failed to read response body", zap.Error(err))
-			} else {
-				zap.L().Error("error doing request", zap.Any("response", string(res)), zap.String("url", event.url))
-			}
-		}
+func (s *Whatsmiau) emit(instance *models.Instance, body any) {
+	target := instance.Webhook.Url
+	if meta, ok := body.(wookMeta); ok {
+		_, event := meta.meta()
+		meta.describe(instance)
+		target = webhookURL(instance, event)
+		s.stream.publish(instance.ID, event, body)
 	}
+
+	s.emitter <- emitter{target, body}
 }
 
-func (s *Whatsmiau) emit(body any, url string) {
-	s.emitter <- emitter{url, body}
+// webhookURL resolves where an event is posted: an explicit eventUrls entry
+// wins, otherwise byEvents appends the event to the base url like Evolution
+// does (messages.upsert -> <url>/messages-upsert).
+func webhookURL(instance *models.Instance, event Wook) string {
+	for key, eventURL := range instance.Webhook.EventUrls {
+		if len(eventURL) > 0 && (key == event.Name() || key == string(event)) {
+			return eventURL
+		}
+	}
+
+	base := instance.Webhook.Url
+	if !instance.Webhook.ByEvents || len(base) == 0 {
+		return base
+	}
+
+	suffix := strings.ReplaceAll(string(event), ".", "-")
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return strings.TrimSuffix(base, "/") + "/" + suffix
+	}
+
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/" + suffix
+	return parsed.String()
 }
 
 func (s *Whatsmiau) Handle(id string) whatsmeow.EventHandler {
 	return func(evt any) {
+		s.onSupervisedEvent(id, evt)
+		s.onPresenceEvent(id, evt)
+
 		s.handlerSemaphore <- struct{}{}
 		go func() {
 			defer func() { <-s.handlerSemaphore }()
@@ -126,6 +189,12 @@ func (s *Whatsmiau) Handle(id string) whatsmeow.EventHandler {
 				s.handleGroupInfoEvent(id, instance, e, eventMap)
 			case *events.PushName:
 				s.handlePushNameEvent(id, instance, e, eventMap)
+			case *events.Connected, *events.Disconnected, *events.LoggedOut,
+				*events.StreamReplaced, *events.TemporaryBan, *events.ConnectFailure:
+				s.handleConnectionEvent(id, instance, e, eventMap)
+			case *events.CallOffer, *events.CallOfferNotice, *events.CallAccept,
+				*events.CallTerminate, *events.CallReject:
+				s.handleCallEvent(id, instance, e, eventMap)
 			default:
 				zap.L().Debug("unknown event", zap.String("type", fmt.Sprintf("%T", evt)), zap.Any("raw", evt))
 			}
@@ -182,7 +251,7 @@ func (s *Whatsmiau) handleMessageEvent(id string, instance *models.Instance, e *
 		zap.L().Debug("message event", zap.String("instance", id), zap.Any("data", wookMessage.Data))
 	}
 
-	s.emit(wookMessage, instance.Webhook.Url)
+	s.emit(instance, wookMessage)
 }
 
 func (s *Whatsmiau) handleReceiptEvent(id string, instance *models.Instance, e *events.Receipt, eventMap map[string]bool) {
@@ -207,7 +276,7 @@ func (s *Whatsmiau) handleReceiptEvent(id string, instance *models.Instance, e *
 			Event:    WookMessagesUpdate,
 		}
 
-		s.emit(wookData, instance.Webhook.Url)
+		s.emit(instance, wookData)
 	}
 }
 
@@ -229,7 +298,7 @@ func (s *Whatsmiau) handleBusinessNameEvent(id string, instance *models.Instance
 		Event:    WookContactsUpsert,
 	}
 
-	s.emit(wookData, instance.Webhook.Url)
+	s.emit(instance, wookData)
 }
 
 func (s *Whatsmiau) handleContactEvent(id string, instance *models.Instance, e *events.Contact, eventMap map[string]bool) {
@@ -254,7 +323,7 @@ func (s *Whatsmiau) handleContactEvent(id string, instance *models.Instance, e *
 		Event:    WookContactsUpsert,
 	}
 
-	s.emit(wookData, instance.Webhook.Url)
+	s.emit(instance, wookData)
 }
 
 func (s *Whatsmiau) handlePictureEvent(id string, instance *models.Instance, e *events.Picture, eventMap map[string]bool) {
@@ -274,7 +343,7 @@ func (s *Whatsmiau) handlePictureEvent(id string, instance *models.Instance, e *
 		Event:    WookContactsUpsert,
 	}
 
-	s.emit(wookData, instance.Webhook.Url)
+	s.emit(instance, wookData)
 }
 
 func (s *Whatsmiau) handleHistorySyncEvent(id string, instance *models.Instance, e *events.HistorySync, eventMap map[string]bool) {
@@ -294,7 +363,7 @@ func (s *Whatsmiau) handleHistorySyncEvent(id string, instance *models.Instance,
 		Event:    WookContactsUpsert,
 	}
 
-	s.emit(wookData, instance.Webhook.Url)
+	s.emit(instance, wookData)
 }
 
 func (s *Whatsmiau) handleGroupInfoEvent(id string, instance *models.Instance, e *events.GroupInfo, eventMap map[string]bool) {
@@ -319,7 +388,7 @@ func (s *Whatsmiau) handleGroupInfoEvent(id string, instance *models.Instance, e
 		Event:    WookContactsUpsert,
 	}
 
-	s.emit(wookData, instance.Webhook.Url)
+	s.emit(instance, wookData)
 }
 
 func (s *Whatsmiau) handlePushNameEvent(id string, instance *models.Instance, e *events.PushName, eventMap map[string]bool) {
@@ -344,7 +413,7 @@ func (s *Whatsmiau) handlePushNameEvent(id string, instance *models.Instance, e
 		Event:    WookContactsUpsert,
 	}
 
-	s.emit(wookData, instance.Webhook.Url)
+	s.emit(instance, wookData)
 }
 
 // parseWAMessage converts a raw waE2E.Message into our internal representation.
@@ -452,6 +521,23 @@ func (s *Whatsmiau) parseWAMessage(m *waE2E.Message) (string, *WookMessageRaw, *
 			GIFPlayback:   video.GetGifPlayback(),
 		}
 		ci = video.GetContextInfo()
+	} else if sticker := m.GetStickerMessage(); sticker != nil {
+		messageType = "stickerMessage"
+		ci = sticker.GetContextInfo()
+		raw.StickerMessage = &WookStickerMessageRaw{
+			Url:               sticker.GetURL(),
+			Mimetype:          sticker.GetMimetype(),
+			FileSha256:        b64(sticker.GetFileSHA256()),
+			FileLength:        u64(sticker.GetFileLength()),
+			Height:            int(sticker.GetHeight()),
+			Width:             int(sticker.GetWidth()),
+			MediaKey:          b64(sticker.GetMediaKey()),
+			FileEncSha256:     b64(sticker.GetFileEncSHA256()),
+			DirectPath:        sticker.GetDirectPath(),
+			MediaKeyTimestamp: i64(sticker.GetMediaKeyTimestamp()),
+			IsAnimated:        sticker.GetIsAnimated(),
+			PngThumbnail:      b64(sticker.GetPngThumbnail()),
+		}
 	} else if conv := strings.TrimSpace(m.GetConversation()); conv != "" {
 		messageType = "conversation"
 		raw.Conversation = conv
@@ -610,6 +696,10 @@ func (s *Whatsmiau) convertEventMessage(id string, instance *models.Instance, ev
 		if vid := m.GetVideoMessage(); vid != nil {
 			raw.MediaURL, raw.Base64 = s.uploadMessageFile(ctx, instance, client, vid, vid.GetMimetype(), "")
 		}
+	case "stickerMessage":
+		if sticker := m.GetStickerMessage(); sticker != nil {
+			raw.MediaURL, raw.Base64 = s.uploadMessageFile(ctx, instance, client, sticker, sticker.GetMimetype(), "")
+		}
 	}
 
 	// Map MessageContextInfo (quoted, mentions, disappearing mode, external ad reply)
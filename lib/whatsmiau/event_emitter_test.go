@@ -0,0 +1,73 @@
+package whatsmiau
+
+import (
+	"testing"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+)
+
+func TestWebhookURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook models.InstanceWebhook
+		event   Wook
+		want    string
+	}{
+		{
+			name:    "base url",
+			webhook: models.InstanceWebhook{Url: "https://example.com/hook"},
+			event:   WookMessagesUpsert,
+			want:    "https://example.com/hook",
+		},
+		{
+			name:    "by events",
+			webhook: models.InstanceWebhook{Url: "https://example.com/hook/", ByEvents: true},
+			event:   WookMessagesUpsert,
+			want:    "https://example.com/hook/messages-upsert",
+		},
+		{
+			name:    "by events keeps the query",
+			webhook: models.InstanceWebhook{Url: "https://example.com/hook?token=1", ByEvents: true},
+			event:   WookConnectionUpdate,
+			want:    "https://example.com/hook/connection-update?token=1",
+		},
+		{
+			name:    "by events without url",
+			webhook: models.InstanceWebhook{ByEvents: true},
+			event:   WookMessagesUpsert,
+			want:    "",
+		},
+		{
+			name: "event url by name",
+			webhook: models.InstanceWebhook{Url: "https://example.com/hook", ByEvents: true, EventUrls: map[string]string{
+				"MESSAGES_UPSERT": "https://messages.example.com",
+			}},
+			event: WookMessagesUpsert,
+			want:  "https://messages.example.com",
+		},
+		{
+			name: "event url by event",
+			webhook: models.InstanceWebhook{Url: "https://example.com/hook", EventUrls: map[string]string{
+				"qrcode.updated": "https://qr.example.com",
+			}},
+			event: WookQrCodeUpdated,
+			want:  "https://qr.example.com",
+		},
+		{
+			name: "empty event url falls back",
+			webhook: models.InstanceWebhook{Url: "https://example.com/hook", EventUrls: map[string]string{
+				"CALL": "",
+			}},
+			event: WookCall,
+			want:  "https://example.com/hook",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := webhookURL(&models.Instance{Webhook: tt.webhook}, tt.event); got != tt.want {
+				t.Errorf("webhookURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
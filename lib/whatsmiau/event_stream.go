@@ -0,0 +1,174 @@
+package whatsmiau
+
+import (
+	"encoding/json"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// eventStreamQueueSize is how many events a subscriber may lag behind before
+// it is dropped.
+const eventStreamQueueSize = 256
+
+// StreamEvent is a WookEvent as delivered to stream subscribers. Cursor grows
+// by one for every event published by this process and is used to resume.
+type StreamEvent struct {
+	Cursor   uint64          `json:"cursor"`
+	Instance string          `json:"instance"`
+	Event    Wook            `json:"event"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// EventSubscription receives events on C until it is closed by Unsubscribe or
+// because the subscriber fell too far behind; Dropped tells both apart.
+type EventSubscription struct {
+	C chan StreamEvent
+
+	instance string
+	events   map[string]bool
+	dropped  bool
+}
+
+func (s *EventSubscription) matches(event *StreamEvent) bool {
+	if len(s.instance) > 0 && s.instance != event.Instance {
+		return false
+	}
+
+	return len(s.events) == 0 || s.events[event.Event.Name()] || s.events[string(event.Event)]
+}
+
+// Dropped reports whether the subscription was closed for being too slow.
+// Must only be called after C is closed.
+func (s *EventSubscription) Dropped() bool {
+	return s.dropped
+}
+
+// eventStream fans emitted events out to socket subscribers and keeps the
+// latest ones in a ring buffer so a reconnecting subscriber can catch up.
+type eventStream struct {
+	mu          sync.Mutex
+	cursor      uint64
+	buffer      []StreamEvent
+	next        int
+	subscribers map[*EventSubscription]struct{}
+	queueSize   int
+}
+
+func newEventStream(bufferSize, queueSize int) *eventStream {
+	return &eventStream{
+		buffer:      make([]StreamEvent, 0, max(bufferSize, 0)),
+		subscribers: make(map[*EventSubscription]struct{}),
+		queueSize:   max(queueSize, 1),
+	}
+}
+
+func (s *eventStream) publish(instance string, event Wook, body any) {
+	s.mu.Lock()
+	idle := cap(s.buffer) == 0 && len(s.subscribers) == 0
+	s.mu.Unlock()
+	if idle {
+		return
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		zap.L().Error("failed to marshal stream event", zap.Error(err), zap.String("instance", instance))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor++
+	streamEvent := StreamEvent{
+		Cursor:   s.cursor,
+		Instance: instance,
+		Event:    event,
+		Payload:  payload,
+	}
+
+	if cap(s.buffer) > 0 {
+		if len(s.buffer) < cap(s.buffer) {
+			s.buffer = append(s.buffer, streamEvent)
+		} else {
+			s.buffer[s.next] = streamEvent
+			s.next = (s.next + 1) % cap(s.buffer)
+		}
+	}
+
+	for sub := range s.subscribers {
+		if !sub.matches(&streamEvent) {
+			continue
+		}
+
+		select {
+		case sub.C <- streamEvent:
+		default:
+			// never block the handlers on a slow socket, it can resume from its cursor
+			sub.dropped = true
+			delete(s.subscribers, sub)
+			close(sub.C)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the buffered events after
+// cursor. complete is false when events after cursor were already evicted.
+func (s *eventStream) subscribe(instance string, events []string, cursor uint64) (*EventSubscription, []StreamEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := &EventSubscription{
+		C:        make(chan StreamEvent, s.queueSize),
+		instance: instance,
+		events:   make(map[string]bool, len(events)),
+	}
+	for _, event := range events {
+		sub.events[event] = true
+	}
+	s.subscribers[sub] = struct{}{}
+
+	if cursor == 0 {
+		return sub, nil, true
+	}
+
+	complete := cursor <= s.cursor && (cursor == s.cursor || len(s.buffer) > 0)
+	var backlog []StreamEvent
+	for i := range s.buffer {
+		event := s.buffer[(s.next+i)%len(s.buffer)]
+		if i == 0 && event.Cursor > cursor+1 {
+			complete = false
+		}
+		if event.Cursor > cursor && sub.matches(&event) {
+			backlog = append(backlog, event)
+		}
+	}
+
+	return sub, backlog, complete
+}
+
+func (s *eventStream) unsubscribe(sub *EventSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(s.subscribers, sub)
+	close(sub.C)
+}
+
+// SubscribeEvents streams the events emitted for instance, or for every
+// instance when it is empty, optionally narrowed to the given event names
+// (MESSAGES_UPSERT or messages.upsert). When cursor is set, buffered events
+// after it are returned to be sent first; complete is false if some of them
+// were already evicted from the buffer.
+func (s *Whatsmiau) SubscribeEvents(instance string, events []string, cursor uint64) (*EventSubscription, []StreamEvent, bool) {
+	return s.stream.subscribe(instance, events, cursor)
+}
+
+func (s *Whatsmiau) UnsubscribeEvents(sub *EventSubscription) {
+	s.stream.unsubscribe(sub)
+}
@@ -0,0 +1,324 @@
+package whatsmiau
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// linkPreviewThumbSize is the largest side of the thumbnail, which is sent
+	// inline in the message.
+	linkPreviewThumbSize = 300
+	// linkPreviewMaxPixels refuses images that would take too much memory to
+	// decode, whatever their file size.
+	linkPreviewMaxPixels = 25_000_000
+	linkPreviewRedirects = 3
+)
+
+var (
+	ErrLinkPreviewAddress = errors.New("link preview address is not public")
+
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+	// cgnat is the shared address space of carrier-grade NAT, not covered by
+	// net.IP.IsPrivate.
+	cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+type linkPreview struct {
+	URL         string // as written in the text
+	Title       string
+	Description string
+	Thumbnail   []byte // JPEG
+	Width       int
+	Height      int
+}
+
+// newLinkPreviewClient returns the client previews are fetched with. It only
+// connects to addresses accepted by allowed, publicIP outside of tests, checked
+// on the resolved IP of every connection, so a link can't be used to reach the
+// internal network.
+func newLinkPreviewClient(allowed func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: env.Env.LinkPreviewTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("%w: %s", ErrLinkPreviewAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: env.Env.LinkPreviewTimeout,
+		Transport: &http.Transport{
+			Proxy:                  nil, // a proxy would dial for us
+			DialContext:            dialer.DialContext,
+			TLSHandshakeTimeout:    env.Env.LinkPreviewTimeout,
+			MaxResponseHeaderBytes: 64 << 10,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= linkPreviewRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s not allowed", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!cgnat.Contains(ip)
+}
+
+// firstURL returns the first http(s) link of text, without the punctuation
+// that usually follows it.
+func firstURL(text string) string {
+	for _, match := range urlPattern.FindAllString(text, -1) {
+		match = strings.TrimRight(match, ".,;:!?)]}'")
+		if u, err := url.Parse(match); err == nil && u.Host != "" {
+			return match
+		}
+	}
+
+	return ""
+}
+
+// linkPreview fetches the preview of the first link of text, nil when there
+// is no link or it has no title. Failures are logged and only cost the preview.
+func (s *Whatsmiau) linkPreview(ctx context.Context, text string) *linkPreview {
+	link := firstURL(text)
+	if link == "" {
+		return nil
+	}
+
+	ctx, c := context.WithTimeout(ctx, env.Env.LinkPreviewTimeout)
+	defer c()
+
+	preview, err := s.fetchLinkPreview(ctx, link)
+	if err != nil {
+		zap.L().Warn("failed to fetch link preview", zap.String("url", link), zap.Error(err))
+		return nil
+	}
+
+	return preview
+}
+
+func (s *Whatsmiau) fetchLinkPreview(ctx context.Context, link string) (*linkPreview, error) {
+	body, final, contentType, err := s.fetchPreviewResource(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("not an html page: %s", contentType)
+	}
+
+	meta := parsePreviewMeta(bytes.NewReader(body))
+	if meta.title == "" {
+		return nil, errors.New("page has no title")
+	}
+
+	preview := &linkPreview{
+		URL:         link,
+		Title:       meta.title,
+		Description: meta.description,
+	}
+
+	if meta.image == "" {
+		return preview, nil
+	}
+
+	imageURL, err := final.Parse(meta.image)
+	if err != nil {
+		zap.L().Warn("invalid link preview image", zap.String("url", meta.image), zap.Error(err))
+		return preview, nil
+	}
+
+	data, _, _, err := s.fetchPreviewResource(ctx, imageURL.String())
+	if err == nil {
+		preview.Thumbnail, preview.Width, preview.Height, err = previewThumbnail(data)
+	}
+	if err != nil {
+		zap.L().Warn("failed to get link preview image", zap.String("url", imageURL.String()), zap.Error(err))
+	}
+
+	return preview, nil
+}
+
+// fetchPreviewResource reads up to LINK_PREVIEW_MAX_BYTES of link, failing
+// when it is larger.
+func (s *Whatsmiau) fetchPreviewResource(ctx context.Context, link string) ([]byte, *url.URL, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, nil, "", fmt.Errorf("scheme %s not allowed", req.URL.Scheme)
+	}
+	// many sites only serve their tags to crawlers they know
+	req.Header.Set("User-Agent", "WhatsApp/2 (link preview)")
+
+	res, err := s.previewClient.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, "", fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, env.Env.LinkPreviewMaxBytes+1))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if int64(len(body)) > env.Env.LinkPreviewMaxBytes {
+		return nil, nil, "", fmt.Errorf("larger than %d bytes", env.Env.LinkPreviewMaxBytes)
+	}
+
+	return body, res.Request.URL, res.Header.Get("Content-Type"), nil
+}
+
+type previewMeta struct {
+	title, description, image string
+}
+
+// parsePreviewMeta reads the OpenGraph tags of a page head, falling back to
+// its title and description.
+func parsePreviewMeta(r io.Reader) previewMeta {
+	var (
+		meta     previewMeta
+		title    string
+		desc     string
+		inTitle  bool
+		tokenize = html.NewTokenizer(r)
+	)
+
+	for {
+		switch tokenize.Next() {
+		case html.ErrorToken:
+			return meta.orFallback(title, desc)
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = strings.TrimSpace(string(tokenize.Text()))
+			}
+		case html.EndTagToken:
+			switch tokenize.Token().DataAtom {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return meta.orFallback(title, desc)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenize.Token()
+			switch token.DataAtom {
+			case atom.Title:
+				inTitle = true
+			case atom.Body:
+				return meta.orFallback(title, desc)
+			case atom.Meta:
+				var key, content string
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "property", "name":
+						key = strings.ToLower(attr.Val)
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+
+				switch key {
+				case "og:title":
+					meta.title = content
+				case "og:description":
+					meta.description = content
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if meta.image == "" {
+						meta.image = content
+					}
+				case "description":
+					desc = content
+				}
+			}
+		}
+	}
+}
+
+func (m previewMeta) orFallback(title, description string) previewMeta {
+	if m.title == "" {
+		m.title = title
+	}
+	if m.description == "" {
+		m.description = description
+	}
+	return m
+}
+
+// previewThumbnail scales an image down to linkPreviewThumbSize and encodes
+// it as JPEG.
+func previewThumbnail(data []byte) ([]byte, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if config.Width*config.Height > linkPreviewMaxPixels {
+		return nil, 0, 0, fmt.Errorf("image too large: %dx%d", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, 0, 0, errors.New("empty image")
+	}
+
+	scale := min(1, float64(linkPreviewThumbSize)/float64(max(width, height)))
+	thumbWidth, thumbHeight := max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		for x := 0; x < thumbWidth; x++ {
+			thumb.Set(x, y, img.At(bounds.Min.X+x*width/thumbWidth, bounds.Min.Y+y*height/thumbHeight))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return buf.Bytes(), thumbWidth, thumbHeight, nil
+}
@@ -0,0 +1,275 @@
+package whatsmiau
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"golang.org/x/net/context"
+)
+
+func TestFirstURL(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"no link here", ""},
+		{"see https://example.com", "https://example.com"},
+		{"see https://example.com/a?b=c.", "https://example.com/a?b=c"},
+		{"(http://example.com/path)", "http://example.com/path"},
+		{"first http://a.example, then https://b.example", "http://a.example"},
+		{"ftp://example.com is not http", ""},
+		{"https:// has no host, https://example.org has", "https://example.org"},
+		{`<a href="https://example.com/x">`, "https://example.com/x"},
+	}
+
+	for _, tt := range tests {
+		if got := firstURL(tt.text); got != tt.want {
+			t.Errorf("firstURL(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParsePreviewMeta(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want previewMeta
+	}{
+		{
+			name: "open graph",
+			page: `<html><head><title>Fallback</title>
+				<meta property="og:title" content=" The title ">
+				<meta property="og:description" content="The description">
+				<meta property="og:image" content="/first.png">
+				<meta property="og:image" content="/second.png">
+				</head></html>`,
+			want: previewMeta{title: "The title", description: "The description", image: "/first.png"},
+		},
+		{
+			name: "title and description",
+			page: `<html><head><title> Page </title><meta name="description" content="About the page"></head></html>`,
+			want: previewMeta{title: "Page", description: "About the page"},
+		},
+		{
+			name: "secure image url",
+			page: `<head><meta property="og:title" content="T"><meta property="og:image:secure_url" content="https://example.com/i.png"></head>`,
+			want: previewMeta{title: "T", image: "https://example.com/i.png"},
+		},
+		{
+			name: "stops at the body",
+			page: `<html><title>Head</title><body><meta property="og:title" content="Body"></body></html>`,
+			want: previewMeta{title: "Head"},
+		},
+		{
+			name: "no head",
+			page: `just text`,
+			want: previewMeta{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePreviewMeta(strings.NewReader(tt.page)); got != tt.want {
+				t.Errorf("parsePreviewMeta() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestPreviewThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+		wantErr       bool
+	}{
+		{name: "scaled down", data: testPNG(t, 600, 300), width: 300, height: 150},
+		{name: "portrait", data: testPNG(t, 100, 900), width: 33, height: 300},
+		{name: "small kept", data: testPNG(t, 40, 20), width: 40, height: 20},
+		{name: "not an image", data: []byte("<html>"), wantErr: true},
+		// only the header is read, 6000x6000 is over linkPreviewMaxPixels
+		{name: "too many pixels", data: []byte("GIF89a\x70\x17\x70\x17\x00\x00\x00"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, width, height, err := previewThumbnail(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if width != tt.width || height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+			if config, format, err := image.DecodeConfig(bytes.NewReader(thumb)); err != nil || format != "jpeg" || config.Width != width || config.Height != height {
+				t.Errorf("thumbnail is %s %dx%d (%v), want a %dx%d jpeg", format, config.Width, config.Height, err, width, height)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"100.128.0.1", true},
+	}
+
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+// previewFixture serves a page linking an image, and /redirect/<n>, which
+// redirects n times before serving the page.
+func previewFixture(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	picture := testPNG(t, 600, 300)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>Fixture</title>
+			<meta property="og:description" content="A page">
+			<meta property="og:image" content="/image.png"></head><body></body></html>`)
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(picture)
+	})
+	mux.HandleFunc("/file.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		fmt.Fprint(w, "PK")
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n == 0 {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testPreviewEnv sets the link preview settings for a test.
+func testPreviewEnv(t *testing.T, maxBytes int64) {
+	t.Helper()
+
+	timeout, limit := env.Env.LinkPreviewTimeout, env.Env.LinkPreviewMaxBytes
+	env.Env.LinkPreviewTimeout, env.Env.LinkPreviewMaxBytes = 5*time.Second, maxBytes
+	t.Cleanup(func() {
+		env.Env.LinkPreviewTimeout, env.Env.LinkPreviewMaxBytes = timeout, limit
+	})
+}
+
+func TestFetchLinkPreview(t *testing.T) {
+	testPreviewEnv(t, 1<<20)
+	server := previewFixture(t)
+	s := &Whatsmiau{previewClient: newLinkPreviewClient(func(net.IP) bool { return true })}
+
+	preview, err := s.fetchLinkPreview(context.Background(), server.URL+"/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Title != "Fixture" || preview.Description != "A page" {
+		t.Errorf("got title %q and description %q", preview.Title, preview.Description)
+	}
+	if len(preview.Thumbnail) == 0 || preview.Width != 300 || preview.Height != 150 {
+		t.Errorf("got a %d bytes thumbnail of %dx%d, want 300x150", len(preview.Thumbnail), preview.Width, preview.Height)
+	}
+
+	if _, err := s.fetchLinkPreview(context.Background(), server.URL+"/file.zip"); err == nil {
+		t.Error("expected an error for a page that is not html")
+	}
+}
+
+func TestFetchLinkPreviewSizeCap(t *testing.T) {
+	testPreviewEnv(t, 64)
+	server := previewFixture(t)
+	s := &Whatsmiau{previewClient: newLinkPreviewClient(func(net.IP) bool { return true })}
+
+	_, err := s.fetchLinkPreview(context.Background(), server.URL+"/page")
+	if err == nil || !strings.Contains(err.Error(), "larger than 64 bytes") {
+		t.Fatalf("expected the page to be over the limit, got %v", err)
+	}
+}
+
+func TestFetchLinkPreviewRedirects(t *testing.T) {
+	testPreviewEnv(t, 1<<20)
+	server := previewFixture(t)
+	s := &Whatsmiau{previewClient: newLinkPreviewClient(func(net.IP) bool { return true })}
+
+	// /redirect/1 takes two redirects to reach the page, /redirect/2 three
+	if _, err := s.fetchLinkPreview(context.Background(), server.URL+"/redirect/1"); err != nil {
+		t.Errorf("expected %d redirects to be followed, got %v", linkPreviewRedirects-1, err)
+	}
+	if _, err := s.fetchLinkPreview(context.Background(), server.URL+"/redirect/2"); err == nil || !strings.Contains(err.Error(), "too many redirects") {
+		t.Errorf("expected %d redirects to fail, got %v", linkPreviewRedirects, err)
+	}
+}
+
+func TestLinkPreviewClientRefusesPrivateAddresses(t *testing.T) {
+	testPreviewEnv(t, 1<<20)
+	server := previewFixture(t)
+	s := &Whatsmiau{previewClient: newLinkPreviewClient(publicIP)}
+
+	_, err := s.fetchLinkPreview(context.Background(), server.URL+"/page")
+	if !errors.Is(err, ErrLinkPreviewAddress) {
+		t.Fatalf("expected ErrLinkPreviewAddress, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package whatsmiau
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/net/context"
+)
+
+// sentLogSize bounds the messages remembered per instance, which at the
+// default send rate covers far more than whatsmeow.EditWindow.
+const sentLogSize = 4096
+
+var ErrEditWindowExpired = errors.New("message can no longer be edited")
+
+// sentLog remembers when the last messages of an instance were sent, so edits
+// past whatsmeow.EditWindow are refused instead of being silently ignored by
+// the recipient.
+type sentLog struct {
+	mu    sync.Mutex
+	at    map[types.MessageID]time.Time
+	order []types.MessageID // ring of the keys of at
+	next  int
+}
+
+func (l *sentLog) add(id types.MessageID, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.order) < sentLogSize {
+		l.order = append(l.order, id)
+	} else {
+		delete(l.at, l.order[l.next])
+		l.order[l.next] = id
+		l.next = (l.next + 1) % sentLogSize
+	}
+	l.at[id] = at
+}
+
+func (l *sentLog) get(id types.MessageID) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	at, ok := l.at[id]
+	return at, ok
+}
+
+// sendMessage sends and remembers when, for edits.
+func (s *Whatsmiau) sendMessage(ctx context.Context, client *whatsmeow.Client, id string, to types.JID, message *waE2E.Message) (whatsmeow.SendResponse, error) {
+	res, err := client.SendMessage(ctx, to, message)
+	if err != nil {
+		return res, err
+	}
+
+	log, _ := s.sent.LoadOrCompute(id, func() (*sentLog, bool) {
+		return &sentLog{at: make(map[types.MessageID]time.Time)}, false
+	})
+	log.add(res.ID, res.Timestamp)
+
+	return res, nil
+}
+
+type SendReactionRequest struct {
+	InstanceID  string     `json:"instance_id"`
+	RemoteJID   *types.JID `json:"remote_jid"`
+	MessageID   string     `json:"message_id"`
+	FromMe      bool       `json:"from_me"`
+	Participant *types.JID `json:"participant"` // who sent the message, required in groups
+	Reaction    string     `json:"reaction"`    // an emoji, empty removes the reaction
+}
+
+type SendReactionResponse struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Whatsmiau) SendReaction(ctx context.Context, data *SendReactionRequest) (*SendReactionResponse, error) {
+	client, ok := s.clients.Load(data.InstanceID)
+	if !ok {
+		return nil, whatsmeow.ErrClientIsNil
+	}
+
+	sender, err := messageSender(client, *data.RemoteJID, data.FromMe, data.Participant)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
+	}
+
+	res, err := client.SendMessage(ctx, *data.RemoteJID, client.BuildReaction(*data.RemoteJID, sender, data.MessageID, data.Reaction))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SendReactionResponse{
+		ID:        res.ID,
+		CreatedAt: res.Timestamp,
+	}, nil
+}
+
+type EditMessageRequest struct {
+	InstanceID string     `json:"instance_id"`
+	RemoteJID  *types.JID `json:"remote_jid"`
+	MessageID  string     `json:"message_id"`
+	Text       string     `json:"text"`
+	SentAt     time.Time  `json:"sent_at"` // when the message was sent, if known
+}
+
+type EditMessageResponse struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EditMessage replaces the text of a message sent by the instance. It fails
+// with ErrEditWindowExpired when the message is known to be older than
+// whatsmeow.EditWindow, from SentAt or from the messages sent through it.
+func (s *Whatsmiau) EditMessage(ctx context.Context, data *EditMessageRequest) (*EditMessageResponse, error) {
+	client, ok := s.clients.Load(data.InstanceID)
+	if !ok {
+		return nil, whatsmeow.ErrClientIsNil
+	}
+
+	sentAt := data.SentAt
+	if log, ok := s.sent.Load(data.InstanceID); ok && sentAt.IsZero() {
+		sentAt, _ = log.get(data.MessageID)
+	}
+	if !sentAt.IsZero() && time.Since(sentAt) > whatsmeow.EditWindow {
+		return nil, ErrEditWindowExpired
+	}
+
+	s.touchPresence(data.InstanceID)
+	res, err := client.SendMessage(ctx, *data.RemoteJID, client.BuildEdit(*data.RemoteJID, data.MessageID, &waE2E.Message{
+		Conversation: &data.Text,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EditMessageResponse{
+		ID:        res.ID,
+		CreatedAt: res.Timestamp,
+	}, nil
+}
+
+type RevokeMessageRequest struct {
+	InstanceID  string     `json:"instance_id"`
+	RemoteJID   *types.JID `json:"remote_jid"`
+	MessageID   string     `json:"message_id"`
+	FromMe      bool       `json:"from_me"`
+	Participant *types.JID `json:"participant"` // who sent the message, when a group admin deletes someone else's
+}
+
+type RevokeMessageResponse struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevokeMessage deletes a message for everyone.
+func (s *Whatsmiau) RevokeMessage(ctx context.Context, data *RevokeMessageRequest) (*RevokeMessageResponse, error) {
+	client, ok := s.clients.Load(data.InstanceID)
+	if !ok {
+		return nil, whatsmeow.ErrClientIsNil
+	}
+
+	sender, err := messageSender(client, *data.RemoteJID, data.FromMe, data.Participant)
+	if err != nil {
+		return nil, err
+	}
+
+	s.touchPresence(data.InstanceID)
+	res, err := client.SendMessage(ctx, *data.RemoteJID, client.BuildRevoke(*data.RemoteJID, sender, data.MessageID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevokeMessageResponse{
+		ID:        res.ID,
+		CreatedAt: res.Timestamp,
+	}, nil
+}
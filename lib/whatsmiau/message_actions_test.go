@@ -0,0 +1,44 @@
+package whatsmiau
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestSentLog(t *testing.T) {
+	log := &sentLog{at: make(map[types.MessageID]time.Time)}
+	start := time.Now()
+
+	if _, ok := log.get("missing"); ok {
+		t.Fatal("an unknown message should not be found")
+	}
+
+	log.add("first", start)
+	if at, ok := log.get("first"); !ok || !at.Equal(start) {
+		t.Fatalf("get(first) = %s, %v", at, ok)
+	}
+
+	// filling the ring evicts the oldest messages first
+	for i := 1; i <= sentLogSize; i++ {
+		log.add(types.MessageID("m"+strconv.Itoa(i)), start.Add(time.Duration(i)*time.Second))
+	}
+	if _, ok := log.get("first"); ok {
+		t.Fatal("the oldest message should be evicted")
+	}
+	if len(log.at) != sentLogSize || len(log.order) != sentLogSize {
+		t.Fatalf("log holds %d messages in a ring of %d, want %d", len(log.at), len(log.order), sentLogSize)
+	}
+
+	log.add("last", start.Add(time.Hour))
+	if _, ok := log.get("m1"); ok {
+		t.Fatal("the next oldest message should be evicted")
+	}
+	for _, id := range []types.MessageID{"m2", types.MessageID("m" + strconv.Itoa(sentLogSize)), "last"} {
+		if _, ok := log.get(id); !ok {
+			t.Errorf("%s should still be remembered", id)
+		}
+	}
+}
@@ -1,15 +1,29 @@
 package whatsmiau
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+)
 
 type Wook string
 
 const (
-	WookMessagesUpsert Wook = "messages.upsert"
-	WookMessagesUpdate Wook = "messages.update"
-	WookContactsUpsert Wook = "contacts.upsert"
+	WookMessagesUpsert   Wook = "messages.upsert"
+	WookMessagesUpdate   Wook = "messages.update"
+	WookContactsUpsert   Wook = "contacts.upsert"
+	WookConnectionUpdate Wook = "connection.update"
+	WookQrCodeUpdated    Wook = "qrcode.updated"
+	WookCall             Wook = "call"
+	WookSendMessage      Wook = "send.message"
 )
 
+// Name returns the event as it is configured in webhook.events (MESSAGES_UPSERT).
+func (w Wook) Name() string {
+	return strings.ToUpper(strings.ReplaceAll(string(w), ".", "_"))
+}
+
 type WookEvent[data any] struct {
 	Instance    string    `json:"instance,omitempty"`
 	Data        *data     `json:"data,omitempty"`
@@ -19,6 +33,31 @@ type WookEvent[data any] struct {
 	ServerUrl   string    `json:"server_url,omitempty"`
 	Apikey      string    `json:"apikey,omitempty"`
 	Event       Wook      `json:"event,omitempty"`
+
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// describe copies the instance labels to the event, so receivers can route it
+// without looking the instance up.
+func (e *WookEvent[data]) describe(instance *models.Instance) {
+	e.Tags = instance.Tags
+	e.Metadata = instance.Metadata
+}
+
+// meta exposes the routing fields of any WookEvent to the emitter.
+func (e *WookEvent[data]) meta() (string, Wook) {
+	return e.Instance, e.Event
+}
+
+// chatKey is the chat the event belongs to, if any; the emitter keeps events
+// of the same chat in order.
+func (e *WookEvent[data]) chatKey() string {
+	if keyed, ok := any(e.Data).(interface{ chatKey() string }); ok {
+		return keyed.chatKey()
+	}
+
+	return ""
 }
 
 type WookMessageData struct {
@@ -33,6 +72,14 @@ type WookMessageData struct {
 	Source           string                  `json:"source,omitempty"`
 }
 
+func (d *WookMessageData) chatKey() string {
+	if d == nil || d.Key == nil {
+		return ""
+	}
+
+	return d.Key.RemoteJid
+}
+
 type WookMessageContextInfo struct {
 	EphemeralSettingTimestamp        string                                 `json:"ephemeralSettingTimestamp,omitempty"`
 	DisappearingMode                 *ContextInfoDisappearingMode           `json:"disappearingMode,omitempty"`
@@ -92,6 +139,7 @@ type WookMessageRaw struct {
 	VideoMessage    *WookVideoMessageRaw    `json:"videoMessage,omitempty"`
 	AudioMessage    *WookAudioMessageRaw    `json:"audioMessage,omitempty"`
 	ReactionMessage *ReactionMessageRaw     `json:"reactionMessage,omitempty"`
+	StickerMessage  *WookStickerMessageRaw  `json:"stickerMessage,omitempty"`
 	//MessageContextInfo  WookMessageContextInfo `json:"messageContextInfo,omitempty"`
 
 	ListResponseMessage *WookListMessageRaw `json:"listResponseMessage,omitempty"`
@@ -195,6 +243,21 @@ type WookVideoMessageRaw struct {
 	GIFPlayback   bool   `json:"gifPlayback,omitempty"`
 }
 
+type WookStickerMessageRaw struct {
+	Url               string `json:"url,omitempty"`
+	Mimetype          string `json:"mimetype,omitempty"`
+	FileSha256        string `json:"fileSha256,omitempty"`
+	FileLength        string `json:"fileLength,omitempty"`
+	Height            int    `json:"height,omitempty"`
+	Width             int    `json:"width,omitempty"`
+	MediaKey          string `json:"mediaKey,omitempty"`
+	FileEncSha256     string `json:"fileEncSha256,omitempty"`
+	DirectPath        string `json:"directPath,omitempty"`
+	MediaKeyTimestamp string `json:"mediaKeyTimestamp,omitempty"`
+	IsAnimated        bool   `json:"isAnimated,omitempty"`
+	PngThumbnail      string `json:"pngThumbnail,omitempty"`
+}
+
 type WookImageMessageRaw struct {
 	Url               string           `json:"url,omitempty"`
 	Mimetype          string           `json:"mimetype,omitempty"`
@@ -240,6 +303,14 @@ type WookMessageUpdateData struct {
 	InstanceId     string                  `json:"instanceId,omitempty"`
 }
 
+func (d *WookMessageUpdateData) chatKey() string {
+	if d == nil {
+		return ""
+	}
+
+	return d.RemoteJid
+}
+
 type WookContact struct {
 	RemoteJid     string `json:"remoteJid,omitempty"`
 	RemoteLid     string `json:"remoteLid"`
@@ -250,3 +321,65 @@ type WookContact struct {
 }
 
 type WookContactUpsertData []WookContact
+
+type WookConnectionUpdateData struct {
+	Instance     string `json:"instance"`
+	Wuid         string `json:"wuid,omitempty"`
+	State        string `json:"state"`                  // open, connecting or close
+	StatusReason int    `json:"statusReason,omitempty"` // 401 logged out, 403 banned, 440 replaced...
+	Reason       string `json:"reason,omitempty"`
+	BanExpire    int    `json:"banExpire,omitempty"` // seconds until a temporary ban is lifted
+}
+
+type WookQrCodeUpdatedData struct {
+	QrCode WookQrCode `json:"qrcode"`
+}
+
+type WookQrCode struct {
+	Instance    string `json:"instance"`
+	PairingCode string `json:"pairingCode,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Base64      string `json:"base64,omitempty"`
+}
+
+type WookCallData struct {
+	Id           string    `json:"id"`
+	From         string    `json:"from"`
+	FromLid      string    `json:"fromLid,omitempty"`
+	ChatId       string    `json:"chatId"`
+	ChatLid      string    `json:"chatLid,omitempty"`
+	Date         time.Time `json:"date"`
+	IsVideo      bool      `json:"isVideo"`
+	IsGroup      bool      `json:"isGroup"`
+	Status       string    `json:"status"`           // offer, accept, terminate or reject
+	Reason       string    `json:"reason,omitempty"` // why a call terminated
+	AutoRejected bool      `json:"autoRejected,omitempty"`
+	InstanceId   string    `json:"instanceId,omitempty"`
+}
+
+func (d *WookCallData) chatKey() string {
+	if d == nil {
+		return ""
+	}
+
+	return d.ChatId
+}
+
+// WookSendMessageData reports how an async send ended, Key.Id is set once it
+// was sent.
+type WookSendMessageData struct {
+	Key         *WookKey `json:"key,omitempty"`
+	JobId       string   `json:"jobId"`
+	Status      string   `json:"status"` // sent or failed
+	Error       string   `json:"error,omitempty"`
+	MessageType string   `json:"messageType,omitempty"`
+	InstanceId  string   `json:"instanceId,omitempty"`
+}
+
+func (d *WookSendMessageData) chatKey() string {
+	if d == nil || d.Key == nil {
+		return ""
+	}
+
+	return d.Key.RemoteJid
+}
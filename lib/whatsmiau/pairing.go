@@ -63,6 +63,8 @@ func (s *Whatsmiau) StartPairing(ctx context.Context, instanceID, phoneNumber, c
 
 	// Salvar no cache
 	s.pairingCache.Store(sessionID, session)
+	s.connections.publish(instanceID, ConnectionEvent{Type: ConnectionEventPairingCode, PairingCode: code})
+	s.emitQrCodeUpdated(instanceID, "", code)
 
 	// Iniciar observação do pairing
 	go s.observePairing(client, instanceID, sessionID)
@@ -207,11 +209,18 @@ func (s *Whatsmiau) observePairing(client *whatsmeow.Client, instanceID, session
 				session.Status = "expired"
 				s.pairingCache.Store(sessionID, session)
 			}
+			s.connections.publish(instanceID, ConnectionEvent{Type: ConnectionEventClosed, Reason: "pairing code expired"})
 			return
 
 		case <-ticker.C:
 			// Verificar se está conectado
 			if client.IsLoggedIn() {
+				s.connections.publish(instanceID, ConnectionEvent{Type: ConnectionEventOpen, RemoteJID: client.Store.ID.String()})
+				// a QR code observer of the same client sees the login as well
+				if _, observed := s.observerRunning.Load(instanceID); !observed {
+					s.loggedIn(instanceID, client)
+				}
+
 				// Sucesso - atualizar status
 				if session, ok := s.pairingCache.Load(sessionID); ok {
 					session.Status = "success"
@@ -0,0 +1,167 @@
+package whatsmiau
+
+import (
+	"sync"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// presenceState tracks the global presence of an instance. AlwaysOnline
+// instances stay available with a periodic refresh; the others only go
+// available while sending and back to unavailable once idle, otherwise the
+// phone would stop getting push notifications.
+type presenceState struct {
+	mu      sync.Mutex
+	online  bool
+	idle    *time.Timer
+	refresh context.CancelFunc
+}
+
+func (s *Whatsmiau) presence(id string) *presenceState {
+	state, _ := s.presences.LoadOrCompute(id, func() (*presenceState, bool) {
+		return &presenceState{}, false
+	})
+	return state
+}
+
+// onPresenceEvent sets the presence when the instance (re)connects and stops
+// refreshing it while it is down. It runs in the event handler, so the
+// instance lookup and the presence send are done in the background.
+func (s *Whatsmiau) onPresenceEvent(id string, evt any) {
+	switch evt.(type) {
+	case *events.Connected:
+		go s.connectedPresence(id)
+	case *events.Disconnected, *events.StreamReplaced, *events.LoggedOut,
+		*events.TemporaryBan, *events.ConnectFailure:
+		s.stopPresence(id)
+	}
+}
+
+func (s *Whatsmiau) connectedPresence(id string) {
+	instance := s.getInstanceCached(id)
+	if instance == nil {
+		return
+	}
+
+	// the instance may have dropped again while it was looked up
+	if client, ok := s.clients.Load(id); !ok || !client.IsConnected() {
+		return
+	}
+
+	if instance.AlwaysOnline {
+		s.startPresenceRefresh(id)
+		return
+	}
+	s.setPresence(id, types.PresenceUnavailable)
+}
+
+// touchPresence is called before sending: it makes the instance available and
+// schedules it to go unavailable after PRESENCE_IDLE without sends.
+func (s *Whatsmiau) touchPresence(id string) {
+	instance := s.getInstanceCached(id)
+	if instance == nil {
+		return
+	}
+
+	if instance.AlwaysOnline {
+		s.startPresenceRefresh(id)
+		return
+	}
+
+	state := s.presence(id)
+	state.mu.Lock()
+	online := state.online
+	if state.idle != nil {
+		state.idle.Stop()
+	}
+	state.idle = time.AfterFunc(env.Env.PresenceIdle, func() {
+		s.setPresence(id, types.PresenceUnavailable)
+	})
+	state.mu.Unlock()
+
+	if !online {
+		s.setPresence(id, types.PresenceAvailable)
+	}
+}
+
+func (s *Whatsmiau) startPresenceRefresh(id string) {
+	state := s.presence(id)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.refresh != nil {
+		return
+	}
+	if state.idle != nil {
+		state.idle.Stop()
+		state.idle = nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	state.refresh = cancel
+	go s.refreshPresence(ctx, id)
+}
+
+func (s *Whatsmiau) refreshPresence(ctx context.Context, id string) {
+	ticker := time.NewTicker(env.Env.PresenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		// AlwaysOnline may be turned off while running
+		instance := s.getInstanceCached(id)
+		if instance == nil || !instance.AlwaysOnline {
+			state := s.presence(id)
+			state.mu.Lock()
+			state.refresh = nil
+			state.mu.Unlock()
+			s.setPresence(id, types.PresenceUnavailable)
+			return
+		}
+
+		s.setPresence(id, types.PresenceAvailable)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Whatsmiau) stopPresence(id string) {
+	state, ok := s.presences.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.refresh != nil {
+		state.refresh()
+	}
+	if state.idle != nil {
+		state.idle.Stop()
+	}
+}
+
+func (s *Whatsmiau) setPresence(id string, presence types.Presence) {
+	client, ok := s.clients.Load(id)
+	if !ok || !client.IsLoggedIn() {
+		return
+	}
+
+	if err := client.SendPresence(presence); err != nil {
+		zap.L().Warn("failed to send presence", zap.String("instance", id), zap.String("presence", string(presence)), zap.Error(err))
+		return
+	}
+
+	state := s.presence(id)
+	state.mu.Lock()
+	state.online = presence == types.PresenceAvailable
+	state.mu.Unlock()
+}
@@ -0,0 +1,198 @@
+package whatsmiau
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// RateLimitError is returned by the send methods when a send limit is reached,
+// nothing is sent.
+type RateLimitError struct {
+	Limit      string // instance, recipient or new-contacts
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s send limit reached, retry in %s", e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// recipientBucketsMax bounds the recipient buckets of an instance, full ones
+// are dropped past it as they are the same as a new bucket.
+const recipientBucketsMax = 10000
+
+// bucket is a token bucket refilled at rate tokens per second up to burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// wait is how long until a token is available, refilling the bucket to now.
+func (b *bucket) wait(now time.Time, rate float64, burst int) time.Duration {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func (b *bucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// sendLimiter throttles the sends of an instance. Its state is kept in
+// memory, so it starts over when the process restarts.
+type sendLimiter struct {
+	mu         sync.Mutex
+	instance   bucket
+	recipients map[string]*bucket
+	day        string
+	contacted  map[string]bool // new contacts messaged on day
+}
+
+// sendLimits resolves the limits of an instance: zero uses the env default
+// and a negative value disables the limit.
+type sendLimits struct {
+	rate, recipientRate   float64 // per second
+	burst, recipientBurst int
+	dailyNewContacts      int
+}
+
+func resolveSendLimits(instance *models.Instance) sendLimits {
+	pick := func(value, fallback float64) float64 {
+		if value == 0 {
+			return fallback
+		}
+		return value
+	}
+
+	limits := sendLimits{
+		rate:             pick(instance.SendLimits.Rate, env.Env.SendRate) / 60,
+		burst:            int(pick(float64(instance.SendLimits.Burst), float64(env.Env.SendBurst))),
+		recipientRate:    pick(instance.SendLimits.RecipientRate, env.Env.SendRecipientRate) / 60,
+		recipientBurst:   int(pick(float64(instance.SendLimits.RecipientBurst), float64(env.Env.SendRecipientBurst))),
+		dailyNewContacts: int(pick(float64(instance.SendLimits.DailyNewContacts), float64(env.Env.SendDailyNewContacts))),
+	}
+	limits.burst = max(limits.burst, 1)
+	limits.recipientBurst = max(limits.recipientBurst, 1)
+
+	return limits
+}
+
+// allowSend takes a send from the instance and recipient buckets and, for
+// numbers the device does not know yet, from the daily new contact cap. When
+// any of them is exhausted nothing is taken and a RateLimitError is returned.
+func (s *Whatsmiau) allowSend(ctx context.Context, id string, to types.JID) error {
+	instance, err := s.loadInstanceCached(id)
+	if err != nil {
+		zap.L().Error("failed to get instance, applying the default send limits", zap.String("instance", id), zap.Error(err))
+		instance = &models.Instance{ID: id}
+	}
+	if instance == nil {
+		return nil
+	}
+	limits := resolveSendLimits(instance)
+
+	to = to.ToNonAD()
+	broadcast := to == types.StatusBroadcastJID
+
+	newContact := false
+	if !broadcast && limits.dailyNewContacts > 0 && to.Server == types.DefaultUserServer {
+		newContact = !s.knownContact(ctx, id, to)
+	}
+
+	limiter, _ := s.limiters.LoadOrCompute(id, func() (*sendLimiter, bool) {
+		return &sendLimiter{recipients: make(map[string]*bucket)}, false
+	})
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := time.Now()
+	if limits.rate > 0 {
+		if wait := limiter.instance.wait(now, limits.rate, limits.burst); wait > 0 {
+			return &RateLimitError{Limit: "instance", RetryAfter: wait}
+		}
+	}
+
+	var recipient *bucket
+	if !broadcast && limits.recipientRate > 0 {
+		recipient = limiter.recipient(now, to.String(), limits)
+		if wait := recipient.wait(now, limits.recipientRate, limits.recipientBurst); wait > 0 {
+			return &RateLimitError{Limit: "recipient", RetryAfter: wait}
+		}
+	}
+
+	if newContact {
+		if day := now.Format(time.DateOnly); limiter.day != day {
+			limiter.day = day
+			limiter.contacted = make(map[string]bool)
+		}
+
+		if !limiter.contacted[to.String()] {
+			if len(limiter.contacted) >= limits.dailyNewContacts {
+				tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+				return &RateLimitError{Limit: "new-contacts", RetryAfter: tomorrow.Sub(now)}
+			}
+			limiter.contacted[to.String()] = true
+		}
+	}
+
+	if limits.rate > 0 {
+		limiter.instance.tokens--
+	}
+	if recipient != nil {
+		recipient.tokens--
+	}
+
+	return nil
+}
+
+func (l *sendLimiter) recipient(now time.Time, jid string, limits sendLimits) *bucket {
+	if b, ok := l.recipients[jid]; ok {
+		return b
+	}
+
+	if len(l.recipients) >= recipientBucketsMax {
+		for key, b := range l.recipients {
+			if b.full(now, limits.recipientRate, limits.recipientBurst) {
+				delete(l.recipients, key)
+			}
+		}
+	}
+
+	b := &bucket{}
+	l.recipients[jid] = b
+	return b
+}
+
+// knownContact reports whether the number is in the device contacts, which
+// also holds everyone that has messaged it.
+func (s *Whatsmiau) knownContact(ctx context.Context, id string, jid types.JID) bool {
+	client, ok := s.clients.Load(id)
+	if !ok {
+		return false
+	}
+
+	contact, err := client.Store.Contacts.GetContact(ctx, jid)
+	if err != nil {
+		zap.L().Warn("failed to get contact", zap.String("instance", id), zap.Error(err))
+		return true
+	}
+
+	return contact.Found
+}
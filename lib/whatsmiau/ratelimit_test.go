@@ -0,0 +1,186 @@
+package whatsmiau
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/net/context"
+)
+
+// failingInstances is an InstanceRepository that is unreachable.
+type failingInstances struct{}
+
+var errUnreachable = errors.New("unreachable")
+
+func (failingInstances) Create(context.Context, *models.Instance) error { return errUnreachable }
+func (failingInstances) List(context.Context, string) ([]models.Instance, error) {
+	return nil, errUnreachable
+}
+func (failingInstances) Search(context.Context, *models.InstanceFilter) (*models.InstancePage, error) {
+	return nil, errUnreachable
+}
+func (failingInstances) Update(context.Context, string, *models.InstanceUpdate) (*models.Instance, error) {
+	return nil, errUnreachable
+}
+func (failingInstances) Delete(context.Context, string) error { return errUnreachable }
+
+// newLimitedWhatsmiau returns a Whatsmiau with the instance "a" cached with
+// the given send limits, without a client so every number is a new contact.
+func newLimitedWhatsmiau(limits models.InstanceSendLimits) *Whatsmiau {
+	s := &Whatsmiau{
+		repo:          failingInstances{},
+		clients:       xsync.NewMap[string, *whatsmeow.Client](),
+		instanceCache: xsync.NewMap[string, models.Instance](),
+		limiters:      xsync.NewMap[string, *sendLimiter](),
+		presences:     xsync.NewMap[string, *presenceState](),
+	}
+	s.instanceCache.Store("a", models.Instance{ID: "a", SendLimits: limits})
+
+	return s
+}
+
+func TestBucketWait(t *testing.T) {
+	now := time.Now()
+	var b bucket
+
+	// a new bucket starts full
+	for range 3 {
+		if wait := b.wait(now, 1, 3); wait != 0 {
+			t.Fatalf("wait = %s with tokens left", wait)
+		}
+		b.tokens--
+	}
+
+	if wait := b.wait(now, 1, 3); wait != time.Second {
+		t.Fatalf("wait = %s on an empty bucket, want 1s", wait)
+	}
+	if wait := b.wait(now.Add(250*time.Millisecond), 1, 3); wait != 750*time.Millisecond {
+		t.Fatalf("wait = %s after a partial refill, want 750ms", wait)
+	}
+	if wait := b.wait(now.Add(time.Second), 1, 3); wait != 0 {
+		t.Fatalf("wait = %s once refilled, want 0", wait)
+	}
+
+	// the refill stops at burst
+	b.wait(now.Add(time.Hour), 1, 3)
+	if b.tokens != 3 || !b.full(now.Add(time.Hour), 1, 3) {
+		t.Fatalf("tokens = %v, want the burst of 3", b.tokens)
+	}
+}
+
+func TestAllowSend(t *testing.T) {
+	ctx := context.Background()
+	alice := types.NewJID("5511999990001", types.DefaultUserServer)
+	bob := types.NewJID("5511999990002", types.DefaultUserServer)
+
+	t.Run("instance", func(t *testing.T) {
+		s := newLimitedWhatsmiau(models.InstanceSendLimits{Rate: 1, Burst: 2, RecipientRate: -1, DailyNewContacts: -1})
+		for range 2 {
+			if err := s.allowSend(ctx, "a", alice); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var limited *RateLimitError
+		if err := s.allowSend(ctx, "a", bob); !errors.As(err, &limited) || limited.Limit != "instance" || limited.RetryAfter <= 0 {
+			t.Fatalf("expected the instance limit, got %v", err)
+		}
+	})
+
+	t.Run("recipient", func(t *testing.T) {
+		s := newLimitedWhatsmiau(models.InstanceSendLimits{Rate: -1, RecipientRate: 1, RecipientBurst: 1, DailyNewContacts: -1})
+		if err := s.allowSend(ctx, "a", alice); err != nil {
+			t.Fatal(err)
+		}
+
+		var limited *RateLimitError
+		if err := s.allowSend(ctx, "a", alice); !errors.As(err, &limited) || limited.Limit != "recipient" {
+			t.Fatalf("expected the recipient limit, got %v", err)
+		}
+		if err := s.allowSend(ctx, "a", bob); err != nil {
+			t.Fatalf("another recipient should not be limited: %v", err)
+		}
+		if err := s.allowSend(ctx, "a", types.StatusBroadcastJID); err != nil {
+			t.Fatalf("status broadcasts have no recipient limit: %v", err)
+		}
+	})
+
+	t.Run("new contacts", func(t *testing.T) {
+		s := newLimitedWhatsmiau(models.InstanceSendLimits{Rate: -1, RecipientRate: -1, DailyNewContacts: 1})
+		if err := s.allowSend(ctx, "a", alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.allowSend(ctx, "a", alice); err != nil {
+			t.Fatalf("a number already messaged today should not count again: %v", err)
+		}
+
+		var limited *RateLimitError
+		if err := s.allowSend(ctx, "a", bob); !errors.As(err, &limited) || limited.Limit != "new-contacts" || limited.RetryAfter > 24*time.Hour {
+			t.Fatalf("expected the new contacts limit until tomorrow, got %v", err)
+		}
+		if err := s.allowSend(ctx, "a", types.NewJID("123", types.GroupServer)); err != nil {
+			t.Fatalf("groups are not new contacts: %v", err)
+		}
+	})
+
+	t.Run("nothing taken when limited", func(t *testing.T) {
+		s := newLimitedWhatsmiau(models.InstanceSendLimits{Rate: 1, Burst: 2, RecipientRate: 1, RecipientBurst: 1, DailyNewContacts: -1})
+		if err := s.allowSend(ctx, "a", alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.allowSend(ctx, "a", alice); err == nil {
+			t.Fatal("expected the recipient limit")
+		}
+		// the instance token is still there for another recipient
+		if err := s.allowSend(ctx, "a", bob); err != nil {
+			t.Fatalf("a refused send should not take from the instance bucket: %v", err)
+		}
+	})
+}
+
+func TestAllowSendWithoutInstance(t *testing.T) {
+	rate, burst := env.Env.SendRate, env.Env.SendBurst
+	recipientRate, contacts := env.Env.SendRecipientRate, env.Env.SendDailyNewContacts
+	env.Env.SendRate, env.Env.SendBurst, env.Env.SendRecipientRate, env.Env.SendDailyNewContacts = 1, 1, 0, 0
+	t.Cleanup(func() {
+		env.Env.SendRate, env.Env.SendBurst, env.Env.SendRecipientRate, env.Env.SendDailyNewContacts = rate, burst, recipientRate, contacts
+	})
+
+	// the repository fails for "b", which is not cached: the defaults apply
+	s := newLimitedWhatsmiau(models.InstanceSendLimits{})
+	to := types.NewJID("5511999990001", types.DefaultUserServer)
+	if err := s.allowSend(context.Background(), "b", to); err != nil {
+		t.Fatal(err)
+	}
+
+	var limited *RateLimitError
+	if err := s.allowSend(context.Background(), "b", to); !errors.As(err, &limited) || limited.Limit != "instance" {
+		t.Fatalf("expected the default instance limit, got %v", err)
+	}
+}
+
+func TestAllowSendSkipsBeforeSend(t *testing.T) {
+	idle := env.Env.PresenceIdle
+	env.Env.PresenceIdle = time.Hour
+	t.Cleanup(func() { env.Env.PresenceIdle = idle })
+
+	s := newLimitedWhatsmiau(models.InstanceSendLimits{Rate: 1, Burst: 1, RecipientRate: -1, DailyNewContacts: -1})
+	to := types.NewJID("5511999990001", types.DefaultUserServer)
+
+	ctx, err := s.AllowSend(context.Background(), "a", to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.beforeSend(ctx, "a", to); err != nil {
+		t.Fatalf("a send already allowed should not be limited again: %v", err)
+	}
+	if err := s.beforeSend(context.Background(), "a", to); err == nil {
+		t.Fatal("a send not allowed beforehand should be limited")
+	}
+}
@@ -0,0 +1,241 @@
+package whatsmiau
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/schedules"
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// scheduleClaimLease is how often a message waiting for its instance to
+	// connect is tried again; messages held by this process are tracked in
+	// memory and their lease is extended every scheduleLeaseRenewal until they
+	// are sent, so other replicas don't claim them.
+	scheduleClaimLease   = 30 * time.Second
+	scheduleLeaseRenewal = 10 * time.Second
+	scheduleClaimBatch   = 100
+)
+
+var (
+	ErrInstanceOffline = errors.New("instance is offline")
+
+	errScheduleChanged = errors.New("scheduled message was rescheduled or canceled while queued")
+)
+
+// startScheduler polls the schedule for due messages and hands them to the
+// send queue of their instance.
+func (s *Whatsmiau) startScheduler() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	renewal := time.NewTicker(scheduleLeaseRenewal)
+	defer renewal.Stop()
+
+	for {
+		select {
+		case <-renewal.C:
+			s.extendScheduledLeases()
+			continue
+		case <-ticker.C:
+		}
+
+		ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+		messages, err := s.schedules.Claim(ctx, time.Now(), scheduleClaimLease, scheduleClaimBatch)
+		c()
+		if err != nil {
+			zap.L().Error("failed to claim scheduled messages", zap.Error(err))
+			continue
+		}
+
+		for i := range messages {
+			s.fireScheduled(&messages[i])
+		}
+	}
+}
+
+// extendScheduledLeases keeps the messages waiting in a send queue claimed.
+func (s *Whatsmiau) extendScheduledLeases() {
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+	defer c()
+
+	until := time.Now().Add(scheduleClaimLease)
+	s.scheduled.Range(func(id string, _ bool) bool {
+		if err := s.schedules.ExtendLease(ctx, id, until); err != nil {
+			zap.L().Error("failed to extend scheduled message lease", zap.String("id", id), zap.Error(err))
+		}
+		return true
+	})
+}
+
+func (s *Whatsmiau) fireScheduled(message *models.ScheduledMessage) {
+	if _, held := s.scheduled.LoadOrStore(message.ID, true); held {
+		return
+	}
+
+	client, ok := s.clients.Load(message.InstanceID)
+	if !ok || !client.IsConnected() || !client.IsLoggedIn() {
+		if message.OfflinePolicy == models.OfflinePolicyWait && time.Since(message.SendAt) < env.Env.ScheduleMaxDelay {
+			// claimed again once the lease expires
+			s.scheduled.Delete(message.ID)
+			return
+		}
+
+		s.finishScheduled(message, "", ErrInstanceOffline)
+		return
+	}
+
+	to, err := types.ParseJID(message.RemoteJID)
+	if err != nil {
+		s.finishScheduled(message, "", fmt.Errorf("invalid remote jid: %w", err))
+		return
+	}
+
+	// changed is set when the stored message no longer matches the claimed
+	// one, the record then belongs to whoever changed it
+	var changed bool
+	done := func(job *SendJob) {
+		if changed {
+			s.scheduled.Delete(message.ID)
+			return
+		}
+
+		var err error
+		if job.Status == SendJobFailed {
+			err = errors.New(job.Error)
+		}
+		s.finishScheduled(message, job.MessageID, err)
+	}
+
+	send := func(ctx context.Context) (string, error) {
+		// it may have been canceled or rescheduled while it waited in the queue
+		stored, err := s.schedules.Get(ctx, message.ID)
+		if errors.Is(err, schedules.ErrorNotFound) {
+			changed = true
+			return "", errScheduleChanged
+		}
+		if err != nil {
+			return "", err
+		}
+		if stored.Status != message.Status || !stored.SendAt.Equal(message.SendAt) {
+			changed = true
+			return "", errScheduleChanged
+		}
+
+		return s.sendScheduled(ctx, message, &to)
+	}
+
+	if _, err := s.enqueueSend(message.ID, message.InstanceID, to, scheduledMessageType(message.Type), send, done); err != nil {
+		zap.L().Warn("failed to queue scheduled message, retrying", zap.String("id", message.ID), zap.Error(err))
+		s.scheduled.Delete(message.ID)
+	}
+}
+
+func (s *Whatsmiau) finishScheduled(message *models.ScheduledMessage, messageID string, err error) {
+	defer s.scheduled.Delete(message.ID)
+
+	message.Status = models.ScheduledMessageSent
+	message.MessageID = messageID
+	if err != nil {
+		zap.L().Error("scheduled message failed", zap.String("id", message.ID), zap.String("instance", message.InstanceID), zap.Error(err))
+		message.Status = models.ScheduledMessageFailed
+		message.Error = err.Error()
+	}
+	message.UpdatedAt = time.Now()
+
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+	defer c()
+
+	if err := s.schedules.Update(ctx, message); err != nil && !errors.Is(err, schedules.ErrorNotFound) {
+		zap.L().Error("failed to update scheduled message", zap.String("id", message.ID), zap.Error(err))
+	}
+}
+
+func (s *Whatsmiau) sendScheduled(ctx context.Context, message *models.ScheduledMessage, to *types.JID) (string, error) {
+	switch message.Type {
+	case models.ScheduledText:
+		res, err := s.SendText(ctx, &SendText{
+			Text:       message.Text,
+			InstanceID: message.InstanceID,
+			RemoteJID:  to,
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
+	case models.ScheduledAudio:
+		res, err := s.SendAudio(ctx, &SendAudio{
+			AudioURL:   message.Media,
+			InstanceID: message.InstanceID,
+			RemoteJID:  to,
+			ViewOnce:   message.ViewOnce,
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
+	case models.ScheduledDocument:
+		res, err := s.SendDocument(ctx, &SendDocumentRequest{
+			InstanceID: message.InstanceID,
+			MediaURL:   message.Media,
+			Caption:    message.Caption,
+			FileName:   message.FileName,
+			RemoteJID:  to,
+			Mimetype:   message.Mimetype,
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
+	case models.ScheduledImage:
+		res, err := s.SendImage(ctx, &SendImageRequest{
+			InstanceID: message.InstanceID,
+			MediaURL:   message.Media,
+			Caption:    message.Caption,
+			RemoteJID:  to,
+			Mimetype:   message.Mimetype,
+			ViewOnce:   message.ViewOnce,
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
+	case models.ScheduledVideo:
+		res, err := s.SendVideo(ctx, &SendVideoRequest{
+			InstanceID: message.InstanceID,
+			MediaURL:   message.Media,
+			Caption:    message.Caption,
+			RemoteJID:  to,
+			Mimetype:   message.Mimetype,
+			ViewOnce:   message.ViewOnce,
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
+	}
+
+	return "", fmt.Errorf("unknown message type %q", message.Type)
+}
+
+// scheduledMessageType is the messageType reported for a scheduled type.
+func scheduledMessageType(kind string) string {
+	switch kind {
+	case models.ScheduledText:
+		return "conversation"
+	case models.ScheduledAudio:
+		return "audioMessage"
+	case models.ScheduledImage:
+		return "imageMessage"
+	case models.ScheduledVideo:
+		return "videoMessage"
+	}
+
+	return "documentMessage"
+}
@@ -2,7 +2,10 @@ package whatsmiau
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"regexp"
 	"time"
 
 	"go.mau.fi/whatsmeow"
@@ -12,13 +15,170 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// sendAllowance marks a context whose send was already taken from the send
+// limits by AllowSend.
+type sendAllowance struct {
+	id string
+	to types.JID
+}
+
+// AllowSend takes a send to to from the send limits ahead of the send itself,
+// so they are checked before a typing presence or delay. The send made with
+// the returned context doesn't take another one.
+func (s *Whatsmiau) AllowSend(ctx context.Context, id string, to types.JID) (context.Context, error) {
+	if err := s.allowSend(ctx, id, to); err != nil {
+		return ctx, err
+	}
+
+	return context.WithValue(ctx, sendAllowance{}, sendAllowance{id: id, to: to.ToNonAD()}), nil
+}
+
+// beforeSend is called by every send once its message is ready, right before
+// sending it, so a request that fails earlier doesn't use up the send limits.
+// It enforces them, unless AllowSend already did, and makes the instance
+// available.
+func (s *Whatsmiau) beforeSend(ctx context.Context, id string, to types.JID) error {
+	if allowed, _ := ctx.Value(sendAllowance{}).(sendAllowance); allowed.id != id || allowed.to != to.ToNonAD() {
+		if err := s.allowSend(ctx, id, to); err != nil {
+			return err
+		}
+	}
+
+	s.touchPresence(id)
+	return nil
+}
+
+var ErrParticipantRequired = errors.New("the participant is required for someone else's message in a group")
+
+// Quote is the message a send replies to.
+type Quote struct {
+	MessageID   string         `json:"message_id"`
+	RemoteJID   *types.JID     `json:"remote_jid"`  // chat of the quoted message, the destination when nil
+	Participant *types.JID     `json:"participant"` // who sent the quoted message, required in groups
+	FromMe      bool           `json:"from_me"`
+	Message     *waE2E.Message `json:"message"` // quoted content shown in the reply
+}
+
+// messageSender resolves who sent a message of chat: the instance when
+// fromMe, the participant in groups or the chat itself otherwise.
+func messageSender(client *whatsmeow.Client, chat types.JID, fromMe bool, participant *types.JID) (types.JID, error) {
+	switch {
+	case fromMe && client.Store.ID != nil:
+		return client.Store.ID.ToNonAD(), nil
+	case participant != nil:
+		return participant.ToNonAD(), nil
+	case chat.Server == types.GroupServer:
+		return types.JID{}, ErrParticipantRequired
+	default:
+		return chat.ToNonAD(), nil
+	}
+}
+
+// quoteContext returns the ContextInfo that makes a message sent to to a reply
+// to quote, nil without a quote.
+func quoteContext(client *whatsmeow.Client, to types.JID, quote *Quote) (*waE2E.ContextInfo, error) {
+	if quote == nil || quote.MessageID == "" {
+		return nil, nil
+	}
+
+	chat := to.ToNonAD()
+	if quote.RemoteJID != nil {
+		chat = quote.RemoteJID.ToNonAD()
+	}
+
+	sender, err := messageSender(client, chat, quote.FromMe, quote.Participant)
+	if err != nil {
+		return nil, err
+	}
+
+	message := quote.Message
+	if message == nil {
+		message = &waE2E.Message{Conversation: proto.String("")}
+	}
+
+	info := &waE2E.ContextInfo{
+		StanzaID:      proto.String(quote.MessageID),
+		Participant:   proto.String(sender.String()),
+		QuotedMessage: message,
+	}
+	// only set when quoting a message of another chat
+	if chat != to.ToNonAD() {
+		info.RemoteJID = proto.String(chat.String())
+	}
+
+	return info, nil
+}
+
+var mentionPattern = regexp.MustCompile(`@(\d{8,15})\b`)
+
+// messageContext returns the ContextInfo of a message sent to to: the message
+// it quotes and who it mentions, nil when there is neither.
+func messageContext(client *whatsmeow.Client, to types.JID, text string, quote *Quote, mentioned []types.JID, everyone bool) (*waE2E.ContextInfo, error) {
+	info, err := quoteContext(client, to, quote)
+	if err != nil {
+		return nil, err
+	}
+
+	jids, err := mentionedJIDs(client, to, text, mentioned, everyone)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jids) > 0 {
+		if info == nil {
+			info = &waE2E.ContextInfo{}
+		}
+		info.MentionedJID = jids
+	}
+
+	return info, nil
+}
+
+// mentionedJIDs lists who a message pings, once each: the mentioned JIDs, the
+// @number tokens of its text and, with everyone, every current participant of
+// the group it is sent to.
+func mentionedJIDs(client *whatsmeow.Client, to types.JID, text string, mentioned []types.JID, everyone bool) ([]string, error) {
+	var (
+		jids []string
+		seen = make(map[string]bool)
+	)
+	add := func(jid types.JID) {
+		if key := jid.ToNonAD().String(); !seen[key] {
+			seen[key] = true
+			jids = append(jids, key)
+		}
+	}
+
+	for _, jid := range mentioned {
+		add(jid)
+	}
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		add(types.NewJID(match[1], types.DefaultUserServer))
+	}
+
+	if everyone && to.Server == types.GroupServer {
+		group, err := client.GetGroupInfo(to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get group participants: %w", err)
+		}
+
+		for _, participant := range group.Participants {
+			add(participant.JID)
+		}
+	}
+
+	return jids, nil
+}
+
 type SendText struct {
-	Text           string     `json:"text"`
-	InstanceID     string     `json:"instance_id"`
-	RemoteJID      *types.JID `json:"remote_jid"`
-	QuoteMessageID string     `json:"quote_message_id"`
-	QuoteMessage   string     `json:"quote_message"`
-	Participant    *types.JID `json:"participant"`
+	Text            string      `json:"text"`
+	InstanceID      string      `json:"instance_id"`
+	RemoteJID       *types.JID  `json:"remote_jid"`
+	Quote           *Quote      `json:"quote"`
+	Mentioned       []types.JID `json:"mentioned"`
+	MentionEveryone bool        `json:"mention_everyone"` // every participant of the destination group
+	LinkPreview     bool        `json:"link_preview"`     // preview the first link of the text
 }
 
 type SendTextResponse struct {
@@ -32,32 +192,41 @@ func (s *Whatsmiau) SendText(ctx context.Context, data *SendText) (*SendTextResp
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
-	//rJid := data.RemoteJID.ToNonAD().String()
-	var extendedMessage *waE2E.ExtendedTextMessage
-	if len(data.QuoteMessage) > 0 && len(data.QuoteMessageID) > 0 {
-		extendedMessage = &waE2E.ExtendedTextMessage{
-			//ContextInfo: &waE2E.ContextInfo{ // TODO: implement quoted message
-			//	StanzaID:    &data.QuoteMessageID,
-			//	Participant: &rJid,
-			//	QuotedMessage: &waE2E.Message{
-			//		Conversation: &data.QuoteMessage,
-			//		ProtocolMessage: &waE2E.ProtocolMessage{
-			//			Key: &waCommon.MessageKey{
-			//				RemoteJID:   &rJid,
-			//				FromMe:      &[]bool{true}[0],
-			//				ID:          &data.QuoteMessageID,
-			//				Participant: nil,
-			//			},
-			//		},
-			//	},
-			//},
+	contextInfo, err := messageContext(client, *data.RemoteJID, data.Text, data.Quote, data.Mentioned, data.MentionEveryone)
+	if err != nil {
+		return nil, err
+	}
+
+	var preview *linkPreview
+	if data.LinkPreview {
+		preview = s.linkPreview(ctx, data.Text)
+	}
+
+	// a plain conversation can't carry a context or a preview
+	message := &waE2E.Message{Conversation: &data.Text}
+	if contextInfo != nil || preview != nil {
+		extended := &waE2E.ExtendedTextMessage{
+			Text:        &data.Text,
+			ContextInfo: contextInfo,
+		}
+		if preview != nil {
+			extended.MatchedText = proto.String(preview.URL)
+			extended.Title = proto.String(preview.Title)
+			extended.Description = proto.String(preview.Description)
+			if len(preview.Thumbnail) > 0 {
+				extended.JPEGThumbnail = preview.Thumbnail
+				extended.ThumbnailWidth = proto.Uint32(uint32(preview.Width))
+				extended.ThumbnailHeight = proto.Uint32(uint32(preview.Height))
+			}
 		}
+		message = &waE2E.Message{ExtendedTextMessage: extended}
 	}
 
-	res, err := client.SendMessage(ctx, *data.RemoteJID, &waE2E.Message{
-		Conversation:        &data.Text,
-		ExtendedTextMessage: extendedMessage,
-	})
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
+	}
+
+	res, err := s.sendMessage(ctx, client, data.InstanceID, *data.RemoteJID, message)
 	if err != nil {
 		return nil, err
 	}
@@ -69,13 +238,13 @@ func (s *Whatsmiau) SendText(ctx context.Context, data *SendText) (*SendTextResp
 }
 
 type SendAudio struct {
-	AudioURL       string     `json:"text"`
-	InstanceID     string     `json:"instance_id"`
-	RemoteJID      *types.JID `json:"remote_jid"`
-	QuoteMessageID string     `json:"quote_message_id"`
-	QuoteMessage   string     `json:"quote_message"`
-	Participant    *types.JID `json:"participant"`
-	ViewOnce       bool       `json:"view_once"`
+	AudioURL        string      `json:"text"`
+	InstanceID      string      `json:"instance_id"`
+	RemoteJID       *types.JID  `json:"remote_jid"`
+	Quote           *Quote      `json:"quote"`
+	ViewOnce        bool        `json:"view_once"`
+	Mentioned       []types.JID `json:"mentioned"`
+	MentionEveryone bool        `json:"mention_everyone"`
 }
 
 type SendAudioResponse struct {
@@ -89,6 +258,11 @@ func (s *Whatsmiau) SendAudio(ctx context.Context, data *SendAudio) (*SendAudioR
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	contextInfo, err := messageContext(client, *data.RemoteJID, "", data.Quote, data.Mentioned, data.MentionEveryone)
+	if err != nil {
+		return nil, err
+	}
+
 	resAudio, err := s.getCtx(ctx, data.AudioURL)
 	if err != nil {
 		return nil, err
@@ -121,9 +295,14 @@ func (s *Whatsmiau) SendAudio(ctx context.Context, data *SendAudio) (*SendAudioR
 		DirectPath:    proto.String(uploaded.DirectPath),
 		Waveform:      waveForm,
 		ViewOnce:      proto.Bool(data.ViewOnce),
+		ContextInfo:   contextInfo,
+	}
+
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
 	}
 
-	res, err := client.SendMessage(ctx, *data.RemoteJID, &waE2E.Message{
+	res, err := s.sendMessage(ctx, client, data.InstanceID, *data.RemoteJID, &waE2E.Message{
 		AudioMessage: &audio,
 	})
 	if err != nil {
@@ -137,12 +316,15 @@ func (s *Whatsmiau) SendAudio(ctx context.Context, data *SendAudio) (*SendAudioR
 }
 
 type SendDocumentRequest struct {
-	InstanceID string     `json:"instance_id"`
-	MediaURL   string     `json:"media_url"`
-	Caption    string     `json:"caption"`
-	FileName   string     `json:"file_name"`
-	RemoteJID  *types.JID `json:"remote_jid"`
-	Mimetype   string     `json:"mimetype"`
+	InstanceID      string      `json:"instance_id"`
+	MediaURL        string      `json:"media_url"`
+	Caption         string      `json:"caption"`
+	FileName        string      `json:"file_name"`
+	RemoteJID       *types.JID  `json:"remote_jid"`
+	Mimetype        string      `json:"mimetype"`
+	Quote           *Quote      `json:"quote"`
+	Mentioned       []types.JID `json:"mentioned"`
+	MentionEveryone bool        `json:"mention_everyone"`
 }
 
 type SendDocumentResponse struct {
@@ -156,6 +338,11 @@ func (s *Whatsmiau) SendDocument(ctx context.Context, data *SendDocumentRequest)
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	contextInfo, err := messageContext(client, *data.RemoteJID, data.Caption, data.Quote, data.Mentioned, data.MentionEveryone)
+	if err != nil {
+		return nil, err
+	}
+
 	resMedia, err := s.getCtx(ctx, data.MediaURL)
 	if err != nil {
 		return nil, err
@@ -181,9 +368,14 @@ func (s *Whatsmiau) SendDocument(ctx context.Context, data *SendDocumentRequest)
 		FileEncSHA256: uploaded.FileEncSHA256,
 		DirectPath:    proto.String(uploaded.DirectPath),
 		Caption:       proto.String(data.Caption),
+		ContextInfo:   contextInfo,
+	}
+
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
 	}
 
-	res, err := client.SendMessage(ctx, *data.RemoteJID, &waE2E.Message{
+	res, err := s.sendMessage(ctx, client, data.InstanceID, *data.RemoteJID, &waE2E.Message{
 		DocumentMessage: &doc,
 	})
 	if err != nil {
@@ -197,12 +389,15 @@ func (s *Whatsmiau) SendDocument(ctx context.Context, data *SendDocumentRequest)
 }
 
 type SendImageRequest struct {
-	InstanceID string     `json:"instance_id"`
-	MediaURL   string     `json:"media_url"`
-	Caption    string     `json:"caption"`
-	RemoteJID  *types.JID `json:"remote_jid"`
-	Mimetype   string     `json:"mimetype"`
-	ViewOnce   bool       `json:"view_once"`
+	InstanceID      string      `json:"instance_id"`
+	MediaURL        string      `json:"media_url"`
+	Caption         string      `json:"caption"`
+	RemoteJID       *types.JID  `json:"remote_jid"`
+	Mimetype        string      `json:"mimetype"`
+	ViewOnce        bool        `json:"view_once"`
+	Quote           *Quote      `json:"quote"`
+	Mentioned       []types.JID `json:"mentioned"`
+	MentionEveryone bool        `json:"mention_everyone"`
 }
 
 type SendImageResponse struct {
@@ -216,6 +411,11 @@ func (s *Whatsmiau) SendImage(ctx context.Context, data *SendImageRequest) (*Sen
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	contextInfo, err := messageContext(client, *data.RemoteJID, data.Caption, data.Quote, data.Mentioned, data.MentionEveryone)
+	if err != nil {
+		return nil, err
+	}
+
 	resMedia, err := s.getCtx(ctx, data.MediaURL)
 	if err != nil {
 		return nil, err
@@ -245,9 +445,14 @@ func (s *Whatsmiau) SendImage(ctx context.Context, data *SendImageRequest) (*Sen
 		FileEncSHA256: uploaded.FileEncSHA256,
 		DirectPath:    proto.String(uploaded.DirectPath),
 		ViewOnce:      proto.Bool(data.ViewOnce),
+		ContextInfo:   contextInfo,
+	}
+
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
 	}
 
-	res, err := client.SendMessage(ctx, *data.RemoteJID, &waE2E.Message{
+	res, err := s.sendMessage(ctx, client, data.InstanceID, *data.RemoteJID, &waE2E.Message{
 		ImageMessage: &doc,
 	})
 	if err != nil {
@@ -261,12 +466,15 @@ func (s *Whatsmiau) SendImage(ctx context.Context, data *SendImageRequest) (*Sen
 }
 
 type SendVideoRequest struct {
-	InstanceID string     `json:"instance_id"`
-	MediaURL   string     `json:"media_url"`
-	Caption    string     `json:"caption"`
-	RemoteJID  *types.JID `json:"remote_jid"`
-	Mimetype   string     `json:"mimetype"`
-	ViewOnce   bool       `json:"view_once"`
+	InstanceID      string      `json:"instance_id"`
+	MediaURL        string      `json:"media_url"`
+	Caption         string      `json:"caption"`
+	RemoteJID       *types.JID  `json:"remote_jid"`
+	Mimetype        string      `json:"mimetype"`
+	ViewOnce        bool        `json:"view_once"`
+	Quote           *Quote      `json:"quote"`
+	Mentioned       []types.JID `json:"mentioned"`
+	MentionEveryone bool        `json:"mention_everyone"`
 }
 
 type SendVideoResponse struct {
@@ -280,6 +488,11 @@ func (s *Whatsmiau) SendVideo(ctx context.Context, data *SendVideoRequest) (*Sen
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	contextInfo, err := messageContext(client, *data.RemoteJID, data.Caption, data.Quote, data.Mentioned, data.MentionEveryone)
+	if err != nil {
+		return nil, err
+	}
+
 	resMedia, err := s.getCtx(ctx, data.MediaURL)
 	if err != nil {
 		return nil, err
@@ -312,9 +525,14 @@ func (s *Whatsmiau) SendVideo(ctx context.Context, data *SendVideoRequest) (*Sen
 		FileEncSHA256: uploaded.FileEncSHA256,
 		DirectPath:    proto.String(uploaded.DirectPath),
 		ViewOnce:      proto.Bool(data.ViewOnce),
+		ContextInfo:   contextInfo,
+	}
+
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
 	}
 
-	res, err := client.SendMessage(ctx, *data.RemoteJID, &waE2E.Message{
+	res, err := s.sendMessage(ctx, client, data.InstanceID, *data.RemoteJID, &waE2E.Message{
 		VideoMessage: &video,
 	})
 	if err != nil {
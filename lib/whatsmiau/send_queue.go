@@ -0,0 +1,198 @@
+package whatsmiau
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/verbeux-ai/whatsmiau/env"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// SendJob statuses
+const (
+	SendJobQueued  = "queued"
+	SendJobRunning = "running"
+	SendJobSent    = "sent"
+	SendJobFailed  = "failed"
+)
+
+const (
+	// sendJobTimeout bounds a job, typing delay and media download included.
+	sendJobTimeout = 10 * time.Minute
+	// sendJobThrottleWait is the longest a job waits for a send limit before
+	// failing, longer waits like the daily new contact cap fail right away.
+	sendJobThrottleWait = 2 * time.Minute
+)
+
+var ErrSendQueueFull = errors.New("send queue is full")
+
+// SendFunc performs a send, typing simulation included, and returns the ID of
+// the sent message.
+type SendFunc func(ctx context.Context) (messageID string, err error)
+
+type SendJob struct {
+	ID          string    `json:"id"`
+	InstanceID  string    `json:"instanceId"`
+	RemoteJID   string    `json:"remoteJid"`
+	MessageType string    `json:"messageType"`
+	Status      string    `json:"status"`
+	MessageID   string    `json:"messageId,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	send SendFunc
+	done func(*SendJob)
+}
+
+// EnqueueSend queues send to run in the background after the other jobs of the
+// instance, so they are sent in order. The result is reported by the
+// SEND_MESSAGE event and GetSendJob.
+func (s *Whatsmiau) EnqueueSend(instanceID string, to types.JID, messageType string, send SendFunc) (*SendJob, error) {
+	return s.enqueueSend(uuid.NewString(), instanceID, to, messageType, send, nil)
+}
+
+// enqueueSend queues a job with the given ID, done is called once it ended.
+func (s *Whatsmiau) enqueueSend(id, instanceID string, to types.JID, messageType string, send SendFunc, done func(*SendJob)) (*SendJob, error) {
+	if _, ok := s.clients.Load(instanceID); !ok {
+		return nil, whatsmeow.ErrClientIsNil
+	}
+
+	queue, _ := s.sendQueues.LoadOrCompute(instanceID, func() (chan string, bool) {
+		queue := make(chan string, env.Env.SendQueueSize)
+		go s.runSendQueue(instanceID, queue)
+		return queue, false
+	})
+
+	now := time.Now()
+	job := SendJob{
+		ID:          id,
+		InstanceID:  instanceID,
+		RemoteJID:   to.String(),
+		MessageType: messageType,
+		Status:      SendJobQueued,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		send:        send,
+		done:        done,
+	}
+	s.sendJobs.Store(job.ID, job)
+
+	select {
+	case queue <- job.ID:
+		return &job, nil
+	default:
+		s.sendJobs.Delete(job.ID)
+		return nil, ErrSendQueueFull
+	}
+}
+
+// GetSendJob returns a job until SEND_JOB_RETENTION after it finished.
+func (s *Whatsmiau) GetSendJob(id string) (*SendJob, bool) {
+	job, ok := s.sendJobs.Load(id)
+	if !ok {
+		return nil, false
+	}
+
+	return &job, true
+}
+
+func (s *Whatsmiau) runSendQueue(instanceID string, queue chan string) {
+	for id := range queue {
+		job, ok := s.sendJobs.Load(id)
+		if !ok {
+			continue
+		}
+
+		s.updateSendJob(&job, SendJobRunning, "", nil)
+		messageID, err := s.runSendJob(&job)
+		done := job.done
+		job.send, job.done = nil, nil // not needed anymore, let the request go
+		if err != nil {
+			zap.L().Error("send job failed", zap.String("instance", instanceID), zap.String("job", job.ID), zap.Error(err))
+			s.updateSendJob(&job, SendJobFailed, "", err)
+		} else {
+			s.updateSendJob(&job, SendJobSent, messageID, nil)
+		}
+
+		if done != nil {
+			done(&job)
+		}
+		s.emitSendJob(&job)
+		time.AfterFunc(env.Env.SendJobRetention, func() {
+			s.sendJobs.Delete(id)
+		})
+	}
+}
+
+// runSendJob sends, waiting out short send limits since queued sends are not
+// in a hurry. Sends check the limits with AllowSend before any presence or
+// delay, so a retry doesn't repeat them. A panic fails the job instead of the
+// process, as echo's Recover did for synchronous sends.
+func (s *Whatsmiau) runSendJob(job *SendJob) (messageID string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zap.L().Error("send job panicked", zap.String("job", job.ID), zap.Any("panic", r), zap.Stack("stack"))
+			messageID, err = "", fmt.Errorf("send panicked: %v", r)
+		}
+	}()
+
+	ctx, c := context.WithTimeout(context.Background(), sendJobTimeout)
+	defer c()
+
+	for {
+		messageID, err := job.send(ctx)
+
+		var limited *RateLimitError
+		if !errors.As(err, &limited) || limited.RetryAfter > sendJobThrottleWait {
+			return messageID, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(limited.RetryAfter):
+		}
+	}
+}
+
+func (s *Whatsmiau) updateSendJob(job *SendJob, status, messageID string, err error) {
+	job.Status = status
+	job.MessageID = messageID
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.UpdatedAt = time.Now()
+	s.sendJobs.Store(job.ID, *job)
+}
+
+func (s *Whatsmiau) emitSendJob(job *SendJob) {
+	instance := s.getInstanceCached(job.InstanceID)
+	if instance == nil || !slices.Contains(instance.Webhook.Events, WookSendMessage.Name()) {
+		return
+	}
+
+	s.emit(instance, &WookEvent[WookSendMessageData]{
+		Instance: instance.ID,
+		Data: &WookSendMessageData{
+			Key: &WookKey{
+				RemoteJid: job.RemoteJID,
+				FromMe:    true,
+				Id:        job.MessageID,
+			},
+			JobId:       job.ID,
+			Status:      job.Status,
+			Error:       job.Error,
+			MessageType: job.MessageType,
+			InstanceId:  instance.ID,
+		},
+		DateTime: time.Now(),
+		Event:    WookSendMessage,
+	})
+}
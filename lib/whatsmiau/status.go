@@ -53,6 +53,10 @@ func (s *Whatsmiau) SendStatusText(ctx context.Context, data *SendStatusTextRequ
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	if err := s.allowSend(ctx, data.InstanceID, types.StatusBroadcastJID); err != nil {
+		return nil, err
+	}
+
 	// Converter cor de fundo para ARGB
 	backgroundArgb := parseBackgroundColor(data.Background)
 
@@ -83,6 +87,10 @@ func (s *Whatsmiau) SendStatusImage(ctx context.Context, data *SendStatusImageRe
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	if err := s.allowSend(ctx, data.InstanceID, types.StatusBroadcastJID); err != nil {
+		return nil, err
+	}
+
 	// Baixar e fazer upload da imagem
 	resMedia, err := s.getCtx(ctx, data.MediaURL)
 	if err != nil {
@@ -142,6 +150,10 @@ func (s *Whatsmiau) SendStatusVideo(ctx context.Context, data *SendStatusVideoRe
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	if err := s.allowSend(ctx, data.InstanceID, types.StatusBroadcastJID); err != nil {
+		return nil, err
+	}
+
 	// Baixar e fazer upload do vídeo
 	resMedia, err := s.getCtx(ctx, data.MediaURL)
 	if err != nil {
@@ -201,6 +213,10 @@ func (s *Whatsmiau) SendStatusAudio(ctx context.Context, data *SendStatusAudioRe
 		return nil, whatsmeow.ErrClientIsNil
 	}
 
+	if err := s.allowSend(ctx, data.InstanceID, types.StatusBroadcastJID); err != nil {
+		return nil, err
+	}
+
 	// Baixar e fazer upload do áudio
 	resMedia, err := s.getCtx(ctx, data.MediaURL)
 	if err != nil {
@@ -0,0 +1,403 @@
+package whatsmiau
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/verbeux-ai/whatsmiau/env"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	stickerSize = 512
+	// stickerMaxSeconds and stickerFPS keep animated stickers under the size
+	// WhatsApp accepts.
+	stickerMaxSeconds = 10
+	stickerFPS        = 15
+
+	DefaultStickerPackName = "WhatsMiau"
+)
+
+var (
+	ErrStickerFormat   = errors.New("sticker must be a PNG, JPEG, GIF or WebP image")
+	ErrStickerTooLarge = errors.New("sticker is too large")
+
+	errGIFMalformed = errors.New("malformed gif")
+)
+
+type SendStickerRequest struct {
+	InstanceID    string     `json:"instance_id"`
+	MediaURL      string     `json:"media_url"`
+	Data          []byte     `json:"data"` // the image itself, instead of MediaURL
+	RemoteJID     *types.JID `json:"remote_jid"`
+	PackName      string     `json:"pack_name"`
+	PackPublisher string     `json:"pack_publisher"`
+	Quote         *Quote     `json:"quote"`
+}
+
+type SendStickerResponse struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SendSticker converts a PNG, JPEG, GIF or WebP image to a 512x512 WebP
+// sticker, animated for animated GIFs and WebPs, tagged with the sticker pack.
+func (s *Whatsmiau) SendSticker(ctx context.Context, data *SendStickerRequest) (*SendStickerResponse, error) {
+	client, ok := s.clients.Load(data.InstanceID)
+	if !ok {
+		return nil, whatsmeow.ErrClientIsNil
+	}
+
+	contextInfo, err := messageContext(client, *data.RemoteJID, "", data.Quote, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBytes := data.Data
+	if dataBytes == nil {
+		resMedia, err := s.getCtx(ctx, data.MediaURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resMedia.Body.Close()
+
+		dataBytes, err = io.ReadAll(io.LimitReader(resMedia.Body, env.Env.StickerMaxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(dataBytes)) > env.Env.StickerMaxBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrStickerTooLarge, env.Env.StickerMaxBytes)
+	}
+
+	sticker, animated, width, height, err := convertSticker(ctx, dataBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	packName := data.PackName
+	if packName == "" {
+		packName = DefaultStickerPackName
+	}
+	sticker, err = webpWithExif(sticker, stickerExif(packName, data.PackPublisher), width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded, err := client.Upload(ctx, sticker, whatsmeow.MediaImage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.beforeSend(ctx, data.InstanceID, *data.RemoteJID); err != nil {
+		return nil, err
+	}
+
+	res, err := s.sendMessage(ctx, client, data.InstanceID, *data.RemoteJID, &waE2E.Message{
+		StickerMessage: &waE2E.StickerMessage{
+			URL:               proto.String(uploaded.URL),
+			Mimetype:          proto.String("image/webp"),
+			FileSHA256:        uploaded.FileSHA256,
+			FileEncSHA256:     uploaded.FileEncSHA256,
+			FileLength:        proto.Uint64(uploaded.FileLength),
+			MediaKey:          uploaded.MediaKey,
+			DirectPath:        proto.String(uploaded.DirectPath),
+			MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+			Width:             proto.Uint32(uint32(width)),
+			Height:            proto.Uint32(uint32(height)),
+			IsAnimated:        proto.Bool(animated),
+			ContextInfo:       contextInfo,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SendStickerResponse{
+		ID:        res.ID,
+		CreatedAt: res.Timestamp,
+	}, nil
+}
+
+// convertSticker scales data to fit stickerSize, padded with transparency,
+// and encodes it as WebP, returning it with its size. Animated WebPs are sent
+// as they are since ffmpeg can't decode them, as long as they fit stickerSize.
+func convertSticker(ctx context.Context, data []byte) ([]byte, bool, int, int, error) {
+	var animated bool
+	switch http.DetectContentType(data) {
+	case "image/png", "image/jpeg":
+	case "image/gif":
+		frames, err := gifFrames(data, 2)
+		if err != nil {
+			return nil, false, 0, 0, err
+		}
+		animated = frames > 1
+	case "image/webp":
+		if width, height, ok := webpAnimatedCanvas(data); ok {
+			if width > stickerSize || height > stickerSize {
+				return nil, false, 0, 0, fmt.Errorf("%w: animated webp of %dx%d, larger than %[4]dx%[4]d", ErrStickerTooLarge, width, height, stickerSize)
+			}
+			return data, true, width, height, nil
+		}
+	default:
+		return nil, false, 0, 0, ErrStickerFormat
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, false, 0, 0, errors.New("ffmpeg not found in path (install to convert stickers)")
+	}
+
+	dir, err := os.MkdirTemp("", "sticker-*")
+	if err != nil {
+		return nil, false, 0, 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	// the webp muxer seeks back to finish the file, so it can't write to a pipe
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out.webp")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, false, 0, 0, err
+	}
+
+	filter := fmt.Sprintf("scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,format=rgba,pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=0x00000000", stickerSize)
+	args := []string{"-i", in, "-an", "-c:v", "libwebp", "-q:v", "75"}
+	if animated {
+		args = append(args, "-vf", fmt.Sprintf("fps=%d,%s", stickerFPS, filter), "-t", fmt.Sprint(stickerMaxSeconds), "-loop", "0")
+	} else {
+		args = append(args, "-vf", filter, "-frames:v", "1")
+	}
+	args = append(args, "-f", "webp", "-hide_banner", "-loglevel", "error", "-y", out)
+
+	if output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+		return nil, false, 0, 0, fmt.Errorf("failed running ffmpeg: %w: %s", err, bytes.TrimSpace(output))
+	}
+
+	webp, err := os.ReadFile(out)
+	if err != nil {
+		return nil, false, 0, 0, err
+	}
+	if len(webp) == 0 {
+		return nil, false, 0, 0, errors.New("no data after webp conversion")
+	}
+
+	return webp, animated, stickerSize, stickerSize, nil
+}
+
+// gifFrames counts the image descriptors of a GIF, up to limit, walking its
+// blocks without decoding any frame.
+func gifFrames(data []byte, limit int) (int, error) {
+	if len(data) < 13 {
+		return 0, errGIFMalformed
+	}
+
+	// header and logical screen descriptor, then the global color table
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks moves pos past a sequence of sub-blocks ending in an empty one
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errGIFMalformed
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	var frames int
+	for frames < limit {
+		if pos >= len(data) {
+			return 0, errGIFMalformed
+		}
+
+		switch data[pos] {
+		case 0x2c: // image descriptor
+			if pos+11 > len(data) {
+				return 0, errGIFMalformed
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++ // lzw minimum code size
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x21: // extension
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x3b: // trailer
+			return frames, nil
+		default:
+			return 0, errGIFMalformed
+		}
+	}
+
+	return frames, nil
+}
+
+// stickerExif is the EXIF WhatsApp reads the sticker pack from: a single IFD
+// entry, tag 0x5741, holding the pack as JSON.
+func stickerExif(packName, packPublisher string) []byte {
+	pack, _ := json.Marshal(map[string]any{
+		"sticker-pack-id":        uuid.NewString(),
+		"sticker-pack-name":      packName,
+		"sticker-pack-publisher": packPublisher,
+		"emojis":                 []string{},
+	})
+
+	exif := []byte{
+		'I', 'I', 0x2a, 0x00, // little endian TIFF
+		0x08, 0x00, 0x00, 0x00, // offset of the IFD
+		0x01, 0x00, // one entry
+		0x41, 0x57, // tag
+		0x07, 0x00, // undefined type
+		0, 0, 0, 0, // count, set below
+		0x16, 0x00, 0x00, 0x00, // offset of the value, right after the entry
+	}
+	binary.LittleEndian.PutUint32(exif[14:18], uint32(len(pack)))
+
+	return append(exif, pack...)
+}
+
+const (
+	webpFlagAnimation = 0x02
+	webpFlagExif      = 0x08
+	webpFlagAlpha     = 0x10
+)
+
+type webpChunk struct {
+	fourCC string
+	data   []byte
+}
+
+func parseWebP(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a webp file")
+	}
+
+	var chunks []webpChunk
+	for rest := data[12:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return nil, errors.New("truncated webp chunk header")
+		}
+
+		size := int(binary.LittleEndian.Uint32(rest[4:8]))
+		if size > len(rest)-8 {
+			return nil, errors.New("truncated webp chunk")
+		}
+		chunks = append(chunks, webpChunk{fourCC: string(rest[:4]), data: rest[8 : 8+size]})
+
+		rest = rest[8+size:]
+		if size%2 == 1 && len(rest) > 0 {
+			rest = rest[1:]
+		}
+	}
+
+	return chunks, nil
+}
+
+// webpAnimatedCanvas returns the canvas size of an animated WebP, read from
+// its VP8X header.
+func webpAnimatedCanvas(data []byte) (int, int, bool) {
+	chunks, err := parseWebP(data)
+	if err != nil || len(chunks) == 0 || chunks[0].fourCC != "VP8X" || len(chunks[0].data) < 10 {
+		return 0, 0, false
+	}
+
+	header := chunks[0].data
+	if header[0]&webpFlagAnimation == 0 {
+		return 0, 0, false
+	}
+
+	return uint24(header[4:7]) + 1, uint24(header[7:10]) + 1, true
+}
+
+// webpWithExif sets the EXIF of a WebP, turning a simple one into the extended
+// format, which needs the canvas size.
+func webpWithExif(data, exif []byte, width, height int) ([]byte, error) {
+	chunks, err := parseWebP(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chunks) == 0 || chunks[0].fourCC != "VP8X" {
+		var flags byte
+		if len(chunks) > 0 && chunks[0].fourCC == "VP8L" {
+			flags |= webpFlagAlpha // lossless may carry alpha, it's only a hint
+		}
+
+		header := make([]byte, 10)
+		header[0] = flags
+		putUint24(header[4:7], width-1)
+		putUint24(header[7:10], height-1)
+		chunks = append([]webpChunk{{fourCC: "VP8X", data: header}}, chunks...)
+	}
+
+	header := append([]byte(nil), chunks[0].data...)
+	header[0] |= webpFlagExif
+	for _, chunk := range chunks {
+		if chunk.fourCC == "ALPH" {
+			header[0] |= webpFlagAlpha
+		}
+	}
+	chunks[0].data = header
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		if chunk.fourCC == "EXIF" {
+			continue
+		}
+		writeWebPChunk(&body, chunk)
+	}
+	writeWebPChunk(&body, webpChunk{fourCC: "EXIF", data: exif})
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:8], uint32(body.Len()))
+	return append(out, body.Bytes()...), nil
+}
+
+func writeWebPChunk(w *bytes.Buffer, chunk webpChunk) {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(chunk.data)))
+	w.WriteString(chunk.fourCC)
+	w.Write(size[:])
+	w.Write(chunk.data)
+	if len(chunk.data)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
@@ -0,0 +1,291 @@
+package whatsmiau
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// testWebP builds a WebP file out of chunks.
+func testWebP(chunks ...webpChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		writeWebPChunk(&body, chunk)
+	}
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:8], uint32(body.Len()))
+	return append(out, body.Bytes()...)
+}
+
+// testVP8X is a VP8X header with the given flags and canvas size.
+func testVP8X(flags byte, width, height int) webpChunk {
+	header := make([]byte, 10)
+	header[0] = flags
+	putUint24(header[4:7], width-1)
+	putUint24(header[7:10], height-1)
+	return webpChunk{fourCC: "VP8X", data: header}
+}
+
+func testGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for range frames {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStickerExif(t *testing.T) {
+	exif := stickerExif("Pack", "Publisher")
+
+	if string(exif[:4]) != "II*\x00" || binary.LittleEndian.Uint32(exif[4:8]) != 8 {
+		t.Fatalf("not a little endian TIFF header: % x", exif[:8])
+	}
+	if entries := binary.LittleEndian.Uint16(exif[8:10]); entries != 1 {
+		t.Fatalf("%d IFD entries, want 1", entries)
+	}
+	if tag := binary.LittleEndian.Uint16(exif[10:12]); tag != 0x5741 {
+		t.Fatalf("tag %#x, want 0x5741", tag)
+	}
+
+	count := binary.LittleEndian.Uint32(exif[14:18])
+	offset := binary.LittleEndian.Uint32(exif[18:22])
+	if int(offset+count) != len(exif) {
+		t.Fatalf("value of %d bytes at %d, exif is %d bytes", count, offset, len(exif))
+	}
+
+	var pack map[string]any
+	if err := json.Unmarshal(exif[offset:offset+count], &pack); err != nil {
+		t.Fatal(err)
+	}
+	if pack["sticker-pack-name"] != "Pack" || pack["sticker-pack-publisher"] != "Publisher" || pack["sticker-pack-id"] == "" {
+		t.Fatalf("unexpected pack %v", pack)
+	}
+}
+
+func TestParseWebP(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "chunks",
+			data: testWebP(webpChunk{"VP8X", make([]byte, 10)}, webpChunk{"ALPH", []byte{1, 2, 3}}, webpChunk{"VP8 ", []byte{4, 5}}),
+			want: []string{"VP8X", "ALPH", "VP8 "},
+		},
+		{name: "not riff", data: []byte("RIFX\x04\x00\x00\x00WEBP"), wantErr: true},
+		{name: "not webp", data: []byte("RIFF\x04\x00\x00\x00WAVE"), wantErr: true},
+		{name: "truncated header", data: []byte("RIFF\x08\x00\x00\x00WEBPVP8"), wantErr: true},
+		{name: "truncated chunk", data: []byte("RIFF\x10\x00\x00\x00WEBPVP8 \x08\x00\x00\x00\x01"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := parseWebP(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, chunk := range chunks {
+				got = append(got, chunk.fourCC)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("chunks %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the padding byte of an odd chunk is not part of its data
+	chunks, _ := parseWebP(testWebP(webpChunk{"ALPH", []byte{1, 2, 3}}, webpChunk{"VP8 ", []byte{4, 5}}))
+	if !bytes.Equal(chunks[0].data, []byte{1, 2, 3}) || !bytes.Equal(chunks[1].data, []byte{4, 5}) {
+		t.Fatalf("chunk data %v and %v", chunks[0].data, chunks[1].data)
+	}
+}
+
+func TestWebPWithExif(t *testing.T) {
+	exif := stickerExif("Pack", "Publisher")
+
+	tests := []struct {
+		name      string
+		data      []byte
+		want      []string
+		wantFlags byte
+		width     int
+		height    int
+	}{
+		{
+			name:      "simple lossy",
+			data:      testWebP(webpChunk{"VP8 ", []byte{1, 2}}),
+			want:      []string{"VP8X", "VP8 ", "EXIF"},
+			wantFlags: webpFlagExif,
+			width:     512, height: 300,
+		},
+		{
+			name:      "simple lossless",
+			data:      testWebP(webpChunk{"VP8L", []byte{1, 2, 3}}),
+			want:      []string{"VP8X", "VP8L", "EXIF"},
+			wantFlags: webpFlagExif | webpFlagAlpha,
+			width:     512, height: 512,
+		},
+		{
+			name:      "extended with alpha",
+			data:      testWebP(testVP8X(0, 200, 100), webpChunk{"ALPH", []byte{1}}, webpChunk{"VP8 ", []byte{1, 2}}),
+			want:      []string{"VP8X", "ALPH", "VP8 ", "EXIF"},
+			wantFlags: webpFlagExif | webpFlagAlpha,
+			width:     200, height: 100,
+		},
+		{
+			name:      "animated with an exif",
+			data:      testWebP(testVP8X(webpFlagAnimation|webpFlagExif, 300, 300), webpChunk{"ANIM", make([]byte, 6)}, webpChunk{"ANMF", make([]byte, 16)}, webpChunk{"EXIF", []byte("old")}),
+			want:      []string{"VP8X", "ANIM", "ANMF", "EXIF"},
+			wantFlags: webpFlagAnimation | webpFlagExif,
+			width:     300, height: 300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := webpWithExif(tt.data, exif, tt.width, tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := binary.LittleEndian.Uint32(out[4:8]); int(size) != len(out)-8 {
+				t.Fatalf("riff size %d, file is %d bytes", size, len(out))
+			}
+
+			chunks, err := parseWebP(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, chunk := range chunks {
+				got = append(got, chunk.fourCC)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("chunks %q, want %q", got, tt.want)
+			}
+
+			header := chunks[0].data
+			if header[0] != tt.wantFlags {
+				t.Errorf("flags %#x, want %#x", header[0], tt.wantFlags)
+			}
+			if width, height := uint24(header[4:7])+1, uint24(header[7:10])+1; width != tt.width || height != tt.height {
+				t.Errorf("canvas %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+			if last := chunks[len(chunks)-1]; !bytes.Equal(last.data, exif) {
+				t.Errorf("exif not replaced: %q", last.data)
+			}
+		})
+	}
+
+	if _, err := webpWithExif([]byte("not a webp"), exif, 512, 512); err == nil {
+		t.Error("expected an error for a file that is not a webp")
+	}
+}
+
+func TestWebPAnimatedCanvas(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+		animated      bool
+	}{
+		{name: "animated", data: testWebP(testVP8X(webpFlagAnimation, 512, 400), webpChunk{"ANIM", make([]byte, 6)}), width: 512, height: 400, animated: true},
+		{name: "extended still", data: testWebP(testVP8X(webpFlagAlpha, 512, 512), webpChunk{"VP8 ", []byte{1}})},
+		{name: "simple", data: testWebP(webpChunk{"VP8 ", []byte{1}})},
+		{name: "short header", data: testWebP(webpChunk{"VP8X", []byte{webpFlagAnimation}})},
+		{name: "not a webp", data: []byte("GIF89a")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, animated := webpAnimatedCanvas(tt.data)
+			if width != tt.width || height != tt.height || animated != tt.animated {
+				t.Errorf("webpAnimatedCanvas() = %d, %d, %v, want %d, %d, %v", width, height, animated, tt.width, tt.height, tt.animated)
+			}
+		})
+	}
+}
+
+func TestGIFFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{name: "still", data: testGIF(t, 1), limit: 2, want: 1},
+		{name: "animated", data: testGIF(t, 5), limit: 2, want: 2},
+		{name: "all frames", data: testGIF(t, 5), limit: 10, want: 5},
+		{name: "truncated", data: testGIF(t, 1)[:20], limit: 2, wantErr: true},
+		{name: "too short", data: []byte("GIF89a"), limit: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := gifFrames(tt.data, tt.limit)
+			if tt.wantErr {
+				if !errors.Is(err, errGIFMalformed) {
+					t.Fatalf("expected errGIFMalformed, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frames != tt.want {
+				t.Errorf("gifFrames() = %d, want %d", frames, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertStickerWithoutFFmpeg(t *testing.T) {
+	animated := testWebP(testVP8X(webpFlagAnimation, 320, 240), webpChunk{"ANIM", make([]byte, 6)})
+	out, isAnimated, width, height, err := convertSticker(context.Background(), animated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, animated) || !isAnimated || width != 320 || height != 240 {
+		t.Errorf("animated webp should be kept as is with its canvas, got animated %v at %dx%d", isAnimated, width, height)
+	}
+
+	oversized := testWebP(testVP8X(webpFlagAnimation, 1024, 512), webpChunk{"ANIM", make([]byte, 6)})
+	if _, _, _, _, err := convertSticker(context.Background(), oversized); !errors.Is(err, ErrStickerTooLarge) {
+		t.Errorf("expected ErrStickerTooLarge, got %v", err)
+	}
+
+	if _, _, _, _, err := convertSticker(context.Background(), []byte("%PDF-1.7")); !errors.Is(err, ErrStickerFormat) {
+		t.Errorf("expected ErrStickerFormat, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package whatsmiau
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+var ErrNoSession = errors.New("instance has no whatsapp session, connect it first")
+
+// keepAliveFailures is how many keepalive pings in a row can fail before the
+// connection is dropped as dead. whatsmeow only does it with auto-reconnect.
+const keepAliveFailures = 3
+
+// supervisor keeps a logged in instance connected. whatsmeow's own
+// auto-reconnect is disabled so that every reconnection goes through here,
+// with a jittered backoff and a state visible through Status.
+type supervisor struct {
+	mu       sync.Mutex
+	client   *whatsmeow.Client
+	state    Status
+	reason   string
+	attempts int
+	cancel   context.CancelFunc // set while a reconnect loop runs
+}
+
+func (s *supervisor) set(state Status, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.reason = reason
+}
+
+func (s *supervisor) status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// supervise starts supervising the client of an instance, replacing the
+// previous client if the instance logged in again.
+func (s *Whatsmiau) supervise(id string, client *whatsmeow.Client) *supervisor {
+	client.EnableAutoReconnect = false
+	sup, _ := s.supervisors.LoadOrCompute(id, func() (*supervisor, bool) {
+		return &supervisor{client: client}, false
+	})
+
+	sup.mu.Lock()
+	sup.client = client
+	sup.mu.Unlock()
+
+	return sup
+}
+
+// onSupervisedEvent drives the supervisor of an instance from the connection
+// events of its client. It runs synchronously in the event handler so the
+// events are seen in order.
+func (s *Whatsmiau) onSupervisedEvent(id string, evt any) {
+	client, ok := s.clients.Load(id)
+	if !ok {
+		return
+	}
+
+	switch e := evt.(type) {
+	case *events.Connected:
+		sup := s.supervise(id, client)
+		sup.mu.Lock()
+		sup.state = Connected
+		sup.reason = ""
+		sup.attempts = 0
+		sup.mu.Unlock()
+	case *events.Disconnected:
+		s.reconnect(id, client, 0, "disconnected")
+	case *events.KeepAliveTimeout:
+		if e.ErrorCount >= keepAliveFailures {
+			// a half-open socket would otherwise stay up until TCP gives up
+			client.Disconnect()
+			s.reconnect(id, client, 0, "keepalive timeout")
+		}
+	case *events.StreamReplaced:
+		s.reconnect(id, client, 0, "stream replaced")
+	case *events.TemporaryBan:
+		s.reconnect(id, client, e.Expire, "temporary ban")
+	case *events.ConnectFailure:
+		if e.Reason.IsLoggedOut() {
+			s.supervise(id, client).set(Failed, "logged out: "+e.Reason.String())
+			return
+		}
+		s.reconnect(id, client, 0, "connect failure: "+e.Reason.String())
+	case *events.LoggedOut:
+		s.supervise(id, client).set(Failed, "logged out: "+e.Reason.String())
+	}
+}
+
+// reconnect starts the reconnect loop of the instance unless one is running.
+// delay, when set, is waited before the first attempt instead of the backoff.
+func (s *Whatsmiau) reconnect(id string, client *whatsmeow.Client, delay time.Duration, reason string) {
+	sup := s.supervise(id, client)
+
+	sup.mu.Lock()
+	if sup.cancel != nil {
+		sup.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sup.cancel = cancel
+	sup.reason = reason
+	sup.mu.Unlock()
+
+	zap.L().Warn("instance disconnected, reconnecting", zap.String("instance", id), zap.String("reason", reason))
+	go s.runReconnect(ctx, id, sup, delay)
+}
+
+func (s *Whatsmiau) runReconnect(ctx context.Context, id string, sup *supervisor, delay time.Duration) {
+	defer func() {
+		sup.mu.Lock()
+		sup.cancel = nil
+		sup.mu.Unlock()
+	}()
+
+	for {
+		sup.mu.Lock()
+		if delay <= 0 {
+			delay = reconnectBackoff(sup.attempts)
+		}
+		sup.state = Backoff
+		sup.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = 0
+
+		sup.mu.Lock()
+		client := sup.client
+		sup.state = Connecting
+		sup.attempts++
+		attempts := sup.attempts
+		sup.mu.Unlock()
+
+		client.Disconnect()
+		err := client.Connect()
+		if err == nil {
+			// the Connected event moves the state to open; a failed login
+			// comes back as another event and restarts the loop
+			return
+		}
+
+		zap.L().Error("failed to reconnect instance",
+			zap.String("instance", id),
+			zap.Int("attempts", attempts),
+			zap.Error(err),
+		)
+
+		if env.Env.ReconnectMaxAttempts > 0 && attempts >= env.Env.ReconnectMaxAttempts {
+			sup.set(Failed, err.Error())
+			zap.L().Error("giving up reconnecting instance, restart it manually", zap.String("instance", id))
+			return
+		}
+	}
+}
+
+// reconnectBackoff doubles from RECONNECT_BASE up to RECONNECT_MAX, keeping
+// half of it random so instances dropped together do not reconnect together.
+func reconnectBackoff(attempts int) time.Duration {
+	backoff := env.Env.ReconnectBase
+	for i := 0; i < attempts && backoff < env.Env.ReconnectMax; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, env.Env.ReconnectMax)
+	if backoff <= 0 {
+		return time.Second
+	}
+
+	half := backoff / 2
+	return half + rand.N(half+1)
+}
+
+// stopSupervisor forgets the supervisor of an instance, cancelling a pending
+// reconnection. Used when the instance is disconnected on purpose.
+func (s *Whatsmiau) stopSupervisor(id string) {
+	sup, ok := s.supervisors.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	if sup.cancel != nil {
+		sup.cancel()
+	}
+}
+
+// StatusReason explains why an instance is reconnecting or failed, if it is.
+func (s *Whatsmiau) StatusReason(id string) string {
+	sup, ok := s.supervisors.Load(id)
+	if !ok {
+		return ""
+	}
+
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	return sup.reason
+}
+
+// Restart drops the connection of an instance and connects it again right
+// away, also recovering an instance that gave up reconnecting.
+func (s *Whatsmiau) Restart(id string) error {
+	client, ok := s.clients.Load(id)
+	if !ok || client.Store.ID == nil {
+		return ErrNoSession
+	}
+
+	s.stopSupervisor(id)
+	sup := s.supervise(id, client)
+	sup.set(Connecting, "")
+
+	client.Disconnect()
+	if err := client.Connect(); err != nil {
+		s.reconnect(id, client, 0, "restart failed: "+err.Error())
+		return err
+	}
+
+	return nil
+}
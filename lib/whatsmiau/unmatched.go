@@ -0,0 +1,106 @@
+package whatsmiau
+
+import (
+	"errors"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.mau.fi/whatsmeow"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// UNMATCHED_DEVICES values
+const (
+	UnmatchedDevicesQuarantine = "quarantine"
+	UnmatchedDevicesLogout     = "logout"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("unmatched device not found")
+	ErrInstanceInUse  = errors.New("instance already has a logged in device")
+)
+
+// ListUnmatchedDevices returns the linked devices that no instance points to.
+// They are kept disconnected until they are adopted or logged out.
+func (s *Whatsmiau) ListUnmatchedDevices() []models.UnmatchedDevice {
+	result := make([]models.UnmatchedDevice, 0)
+	s.unmatched.Range(func(jid string, client *whatsmeow.Client) bool {
+		device := models.UnmatchedDevice{
+			JID:          jid,
+			PushName:     client.Store.PushName,
+			BusinessName: client.Store.BusinessName,
+			Platform:     client.Store.Platform,
+		}
+		if !client.Store.LID.IsEmpty() {
+			device.LID = client.Store.LID.String()
+		}
+		result = append(result, device)
+		return true
+	})
+
+	return result
+}
+
+// AdoptUnmatchedDevice binds an unmatched device to an existing instance and
+// connects it, as if the instance had just logged in with it.
+func (s *Whatsmiau) AdoptUnmatchedDevice(ctx context.Context, jid, instanceID string) error {
+	client, ok := s.unmatched.Load(jid)
+	if !ok {
+		return ErrDeviceNotFound
+	}
+
+	current, ok := s.clients.Load(instanceID)
+	if ok && current.IsLoggedIn() {
+		return ErrInstanceInUse
+	}
+
+	if _, err := s.repo.Update(ctx, instanceID, &models.InstanceUpdate{
+		RemoteJID: &jid,
+	}); err != nil {
+		return err
+	}
+
+	if ok {
+		// a client still waiting for a QR code or pairing code, its observer
+		// only drops it from s.clients while it is still the stored one
+		current.Disconnect()
+	}
+
+	s.unmatched.Delete(jid)
+	s.instanceCache.Delete(instanceID)
+	s.clients.Store(instanceID, client)
+	client.AddEventHandler(s.Handle(instanceID))
+	s.supervise(instanceID, client)
+
+	zap.L().Info("unmatched device adopted", zap.String("jid", jid), zap.String("instance", instanceID))
+	if err := client.Connect(); err != nil {
+		s.reconnect(instanceID, client, 0, "connect failed after adoption")
+		return err
+	}
+
+	return nil
+}
+
+// LogoutUnmatchedDevice unlinks an unmatched device from WhatsApp. This can
+// not be undone, the number has to be linked again.
+func (s *Whatsmiau) LogoutUnmatchedDevice(ctx context.Context, jid string) error {
+	client, ok := s.unmatched.Load(jid)
+	if !ok {
+		return ErrDeviceNotFound
+	}
+
+	if !client.IsConnected() {
+		if err := client.Connect(); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Logout(ctx); err != nil {
+		client.Disconnect()
+		return err
+	}
+
+	s.unmatched.Delete(jid)
+	zap.L().Warn("unmatched device logged out", zap.String("jid", jid))
+	return nil
+}
@@ -0,0 +1,303 @@
+package whatsmiau
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// webhookPostponeDelay is how long a delivery waits in the queue when its
+	// destination is saturated.
+	webhookPostponeDelay = time.Second
+	// webhookDestinationIdle is how long a destination goes unused before its
+	// workers are stopped.
+	webhookDestinationIdle = 5 * time.Minute
+)
+
+// webhookDispatcher fans deliveries out to a set of workers per destination
+// url, so a slow receiver only delays its own events. Deliveries of the same
+// chat wait behind the earlier ones, also while those wait for a retry, so
+// they keep their order.
+type webhookDispatcher struct {
+	deliver      func(*models.WebhookDelivery) bool
+	postpone     func(*models.WebhookDelivery)
+	destinations *xsync.Map[string, *webhookDestination]
+	inFlight     *xsync.Map[string, struct{}]
+	lanesMu      sync.Mutex
+	lanes        map[string]*webhookLane
+	workers      int
+	queueSize    int
+}
+
+type webhookDestination struct {
+	mu       sync.Mutex
+	queues   []chan *models.WebhookDelivery
+	lastUsed time.Time
+	stopped  bool
+}
+
+// webhookLane holds the deliveries of a chat behind its head, which is either
+// with a worker or waiting in the queue until its next attempt.
+type webhookLane struct {
+	head    *models.WebhookDelivery
+	waiting bool
+	until   time.Time
+	next    []*models.WebhookDelivery
+}
+
+// newWebhookDispatcher takes deliver, which reports whether the delivery is
+// finished (delivered or dead-lettered) rather than scheduled for a retry, and
+// postpone, which pushes a delivery back to the queue for a moment.
+func newWebhookDispatcher(workers, queueSize int, deliver func(*models.WebhookDelivery) bool, postpone func(*models.WebhookDelivery)) *webhookDispatcher {
+	return &webhookDispatcher{
+		deliver:      deliver,
+		postpone:     postpone,
+		destinations: xsync.NewMap[string, *webhookDestination](),
+		inFlight:     xsync.NewMap[string, struct{}](),
+		lanes:        make(map[string]*webhookLane),
+		workers:      max(workers, 1),
+		queueSize:    max(queueSize, 1),
+	}
+}
+
+// dispatch hands the delivery to its destination worker without blocking. A
+// delivery already being handled is ignored, one whose chat has an earlier
+// delivery pending is held until that one is finished.
+func (d *webhookDispatcher) dispatch(delivery *models.WebhookDelivery) {
+	if len(delivery.ChatKey) == 0 {
+		if _, loaded := d.inFlight.LoadOrStore(delivery.ID, struct{}{}); loaded {
+			return
+		}
+		if !d.send(delivery) {
+			d.inFlight.Delete(delivery.ID)
+			d.postpone(delivery)
+		}
+		return
+	}
+
+	d.lanesMu.Lock()
+	postponed := d.dispatchInLane(delivery)
+	d.lanesMu.Unlock()
+
+	if postponed != nil {
+		d.postpone(postponed)
+	}
+}
+
+func (d *webhookDispatcher) dispatchInLane(delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	key := laneKey(delivery)
+	lane, ok := d.lanes[key]
+	if !ok {
+		lane = &webhookLane{head: delivery}
+		d.lanes[key] = lane
+		return d.sendHead(lane)
+	}
+
+	if lane.head.ID == delivery.ID {
+		if !lane.waiting {
+			return nil
+		}
+		lane.head = delivery
+		return d.sendHead(lane)
+	}
+
+	if slices.ContainsFunc(lane.next, func(next *models.WebhookDelivery) bool { return next.ID == delivery.ID }) {
+		// claimed again once its lease ran out, it keeps its place
+		return nil
+	}
+	lane.next = append(lane.next, delivery)
+
+	if lane.waiting && time.Since(lane.until) > webhookClaimLease {
+		// the head would have been claimed by now, it was removed from the queue
+		return d.advance(key, lane)
+	}
+
+	return nil
+}
+
+// done releases the delivery after an attempt. A finished delivery lets the
+// next one of its chat go, a failed one holds them until its retry.
+func (d *webhookDispatcher) done(delivery *models.WebhookDelivery, finished bool) {
+	if len(delivery.ChatKey) == 0 {
+		d.inFlight.Delete(delivery.ID)
+		return
+	}
+
+	var postponed *models.WebhookDelivery
+	key := laneKey(delivery)
+
+	d.lanesMu.Lock()
+	if lane, ok := d.lanes[key]; ok && lane.head.ID == delivery.ID {
+		if finished {
+			postponed = d.advance(key, lane)
+		} else {
+			lane.waiting = true
+			lane.until = delivery.NextAttemptAt
+		}
+	}
+	d.lanesMu.Unlock()
+
+	if postponed != nil {
+		d.postpone(postponed)
+	}
+}
+
+// forget drops a delivery removed from the queue, so the deliveries of its
+// chat don't wait for it.
+func (d *webhookDispatcher) forget(delivery *models.WebhookDelivery) {
+	if len(delivery.ChatKey) == 0 {
+		return
+	}
+
+	var postponed *models.WebhookDelivery
+	key := laneKey(delivery)
+
+	d.lanesMu.Lock()
+	if lane, ok := d.lanes[key]; ok {
+		if lane.head.ID != delivery.ID {
+			lane.next = slices.DeleteFunc(lane.next, func(next *models.WebhookDelivery) bool { return next.ID == delivery.ID })
+		} else if lane.waiting {
+			postponed = d.advance(key, lane)
+		}
+	}
+	d.lanesMu.Unlock()
+
+	if postponed != nil {
+		d.postpone(postponed)
+	}
+}
+
+// advance moves the lane to its next delivery, removing it when there is none.
+func (d *webhookDispatcher) advance(key string, lane *webhookLane) *models.WebhookDelivery {
+	if len(lane.next) == 0 {
+		delete(d.lanes, key)
+		return nil
+	}
+
+	lane.head, lane.next = lane.next[0], lane.next[1:]
+	return d.sendHead(lane)
+}
+
+// sendHead hands the head of the lane to a worker, returning it to be
+// postponed when the destination is saturated.
+func (d *webhookDispatcher) sendHead(lane *webhookLane) *models.WebhookDelivery {
+	if d.send(lane.head) {
+		lane.waiting = false
+		return nil
+	}
+
+	lane.waiting = true
+	lane.until = time.Now().Add(webhookPostponeDelay)
+	return lane.head
+}
+
+func (d *webhookDispatcher) send(delivery *models.WebhookDelivery) bool {
+	for {
+		destination, _ := d.destinations.LoadOrCompute(delivery.Url, func() (*webhookDestination, bool) {
+			return d.start(delivery.Url), false
+		})
+
+		destination.mu.Lock()
+		if destination.stopped {
+			// it is being removed, load again to start a new one
+			destination.mu.Unlock()
+			continue
+		}
+
+		destination.lastUsed = time.Now()
+		select {
+		case destination.queues[d.partition(delivery)] <- delivery:
+			destination.mu.Unlock()
+			return true
+		default:
+			destination.mu.Unlock()
+			return false
+		}
+	}
+}
+
+func (d *webhookDispatcher) start(url string) *webhookDestination {
+	destination := &webhookDestination{
+		queues:   make([]chan *models.WebhookDelivery, d.workers),
+		lastUsed: time.Now(),
+	}
+	for i := range destination.queues {
+		destination.queues[i] = make(chan *models.WebhookDelivery, d.queueSize)
+		go d.work(destination.queues[i])
+	}
+	go d.stopWhenIdle(url, destination)
+
+	return destination
+}
+
+// stopWhenIdle stops the workers of a destination that has not been used for
+// webhookDestinationIdle, so urls that are gone don't keep goroutines around.
+func (d *webhookDispatcher) stopWhenIdle(url string, destination *webhookDestination) {
+	ticker := time.NewTicker(webhookDestinationIdle)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		destination.mu.Lock()
+		idle := time.Since(destination.lastUsed) >= webhookDestinationIdle
+		for _, queue := range destination.queues {
+			idle = idle && len(queue) == 0
+		}
+		if !idle {
+			destination.mu.Unlock()
+			continue
+		}
+
+		destination.stopped = true
+		d.destinations.Delete(url)
+		for _, queue := range destination.queues {
+			close(queue)
+		}
+		destination.mu.Unlock()
+		return
+	}
+}
+
+func (d *webhookDispatcher) work(queue chan *models.WebhookDelivery) {
+	for delivery := range queue {
+		d.done(delivery, d.deliver(delivery))
+	}
+}
+
+func (d *webhookDispatcher) partition(delivery *models.WebhookDelivery) int {
+	key := delivery.ChatKey
+	if len(key) == 0 {
+		key = delivery.ID
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(d.workers))
+}
+
+func laneKey(delivery *models.WebhookDelivery) string {
+	return delivery.Url + " " + delivery.InstanceID + " " + delivery.ChatKey
+}
+
+// postponeDelivery pushes a delivery whose destination is saturated back to
+// the queue, to be claimed shortly.
+func (s *Whatsmiau) postponeDelivery(delivery *models.WebhookDelivery) {
+	zap.L().Warn("webhook destination saturated, deferring delivery",
+		zap.String("id", delivery.ID),
+		zap.String("url", delivery.Url),
+	)
+
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+	defer c()
+
+	delivery.NextAttemptAt = time.Now().Add(webhookPostponeDelay)
+	if err := s.webhooks.Schedule(ctx, delivery); err != nil {
+		zap.L().Error("failed to defer webhook delivery", zap.Error(err), zap.String("id", delivery.ID))
+	}
+}
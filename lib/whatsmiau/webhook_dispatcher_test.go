@@ -0,0 +1,126 @@
+package whatsmiau
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+)
+
+// testDispatcher delivers through a stub that reports each attempt on a
+// channel, failing the deliveries marked in fail.
+type testDispatcher struct {
+	*webhookDispatcher
+	mu       sync.Mutex
+	fail     map[string]bool
+	attempts chan string
+}
+
+func newTestDispatcher() *testDispatcher {
+	d := &testDispatcher{fail: make(map[string]bool), attempts: make(chan string, 16)}
+	d.webhookDispatcher = newWebhookDispatcher(2, 16, func(delivery *models.WebhookDelivery) bool {
+		d.mu.Lock()
+		failed := d.fail[delivery.ID]
+		d.mu.Unlock()
+
+		if failed {
+			delivery.NextAttemptAt = time.Now().Add(time.Minute)
+		}
+		d.attempts <- delivery.ID
+		return !failed
+	}, func(*models.WebhookDelivery) {})
+
+	return d
+}
+
+func (d *testDispatcher) setFail(id string, fail bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fail[id] = fail
+}
+
+func (d *testDispatcher) expect(t *testing.T, id string) {
+	t.Helper()
+
+	select {
+	case got := <-d.attempts:
+		if got != id {
+			t.Fatalf("attempted %s, want %s", got, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s was not attempted", id)
+	}
+}
+
+func (d *testDispatcher) expectNone(t *testing.T) {
+	t.Helper()
+
+	select {
+	case got := <-d.attempts:
+		t.Fatalf("attempted %s, want nothing", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func chatDelivery(id, chat string) *models.WebhookDelivery {
+	return &models.WebhookDelivery{ID: id, InstanceID: "instance", Url: "http://example.com", ChatKey: chat}
+}
+
+func TestDispatcherHoldsChatBehindRetry(t *testing.T) {
+	d := newTestDispatcher()
+	d.setFail("a1", true)
+
+	d.dispatch(chatDelivery("a1", "chat-a"))
+	d.expect(t, "a1")
+
+	// the failed delivery waits for its retry, the next one of the chat waits
+	// behind it while other chats go on
+	d.dispatch(chatDelivery("a2", "chat-a"))
+	d.dispatch(chatDelivery("b1", "chat-b"))
+	d.expect(t, "b1")
+	d.expectNone(t)
+
+	// claimed again after its lease, the parked delivery keeps its place
+	d.dispatch(chatDelivery("a2", "chat-a"))
+	d.expectNone(t)
+
+	d.setFail("a1", false)
+	d.dispatch(chatDelivery("a1", "chat-a"))
+	d.expect(t, "a1")
+	d.expect(t, "a2")
+}
+
+func TestDispatcherForgetReleasesChat(t *testing.T) {
+	d := newTestDispatcher()
+	d.setFail("a1", true)
+
+	d.dispatch(chatDelivery("a1", "chat-a"))
+	d.expect(t, "a1")
+	d.dispatch(chatDelivery("a2", "chat-a"))
+	d.dispatch(chatDelivery("a3", "chat-a"))
+	d.expectNone(t)
+
+	d.forget(chatDelivery("a2", "chat-a"))
+	d.forget(chatDelivery("a1", "chat-a"))
+	d.expect(t, "a3")
+	d.expectNone(t)
+}
+
+func TestDispatcherIgnoresDeliveryInFlight(t *testing.T) {
+	d := newTestDispatcher()
+	block := make(chan struct{})
+	d.webhookDispatcher.deliver = func(delivery *models.WebhookDelivery) bool {
+		<-block
+		d.attempts <- delivery.ID
+		return true
+	}
+
+	delivery := &models.WebhookDelivery{ID: "u1", Url: "http://example.com"}
+	d.dispatch(delivery)
+	d.dispatch(delivery)
+	close(block)
+
+	d.expect(t, "u1")
+	d.expectNone(t)
+}
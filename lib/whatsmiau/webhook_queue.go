@@ -0,0 +1,343 @@
+package whatsmiau
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/webhooks"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// webhookClaimLease only matters after a crash: deliveries held by this
+	// process are tracked in memory, claiming them again changes nothing.
+	webhookClaimLease    = 2 * time.Minute
+	webhookClaimBatch    = 100
+	webhookResponseLimit = 4096
+
+	webhookSignatureHeader = "X-Whatsmiau-Signature"
+	webhookDeliveryHeader  = "X-Whatsmiau-Delivery"
+)
+
+type wookMeta interface {
+	meta() (string, Wook)
+	chatKey() string
+	describe(instance *models.Instance)
+}
+
+func (s *Whatsmiau) newDelivery(event emitter) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(event.data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		ID:          uuid.NewString(),
+		Url:         event.url,
+		Payload:     payload,
+		MaxAttempts: env.Env.WebhookMaxAttempts,
+		CreatedAt:   now,
+		// the first attempt is made right away, the queue only takes over if it fails
+		NextAttemptAt: now.Add(webhookClaimLease),
+	}
+
+	if meta, ok := event.data.(wookMeta); ok {
+		instanceID, wook := meta.meta()
+		delivery.InstanceID = instanceID
+		delivery.Event = string(wook)
+		delivery.ChatKey = meta.chatKey()
+		if instance := s.getInstanceCached(instanceID); instance != nil && instance.Webhook.MaxAttempts > 0 {
+			delivery.MaxAttempts = instance.Webhook.MaxAttempts
+		}
+	}
+
+	return delivery, nil
+}
+
+// dispatchDelivery persists the delivery before the first attempt, so it
+// survives a receiver outage or a restart of the process.
+func (s *Whatsmiau) dispatchDelivery(delivery *models.WebhookDelivery) {
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+	defer c()
+
+	if err := s.webhooks.Schedule(ctx, delivery); err != nil {
+		zap.L().Error("failed to persist webhook delivery", zap.Error(err), zap.String("id", delivery.ID))
+	}
+
+	s.dispatcher.dispatch(delivery)
+}
+
+// startRetrier polls the queue for deliveries whose backoff has elapsed.
+func (s *Whatsmiau) startRetrier() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+		deliveries, err := s.webhooks.Claim(ctx, time.Now(), webhookClaimLease, webhookClaimBatch)
+		c()
+		if err != nil {
+			zap.L().Error("failed to claim webhook deliveries", zap.Error(err))
+			continue
+		}
+
+		for i := range deliveries {
+			s.dispatcher.dispatch(&deliveries[i])
+		}
+	}
+}
+
+// deliver makes an attempt, reporting whether the delivery is finished, either
+// delivered or dead-lettered, rather than scheduled for a retry.
+func (s *Whatsmiau) deliver(delivery *models.WebhookDelivery) bool {
+	delivery.Attempts++
+	delivery.LastAttemptAt = time.Now()
+	delivery.LastStatusCode = 0
+	delivery.LastResponse = ""
+	delivery.LastError = ""
+
+	var instance *models.Instance
+	if len(delivery.InstanceID) > 0 {
+		var err error
+		if instance, err = s.loadInstanceCached(delivery.InstanceID); err != nil {
+			// without the instance the headers and signature would be missing
+			delivery.LastError = err.Error()
+			return s.retryOrDeadLetter(delivery)
+		}
+	}
+
+	ctx, c := context.WithTimeout(context.Background(), webhookTimeout(instance))
+	defer c()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		// a malformed url will never succeed, not even with unlimited attempts
+		delivery.LastError = err.Error()
+		s.deadLetter(delivery)
+		return true
+	}
+
+	setWebhookHeaders(req, delivery, instance)
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		delivery.LastError = err.Error()
+		return s.retryOrDeadLetter(delivery)
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if err != nil {
+		zap.L().Warn("failed to read webhook response body", zap.Error(err), zap.String("url", delivery.Url))
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+		defer c()
+		if err := s.webhooks.Done(ctx, delivery); err != nil {
+			zap.L().Error("failed to remove delivered webhook", zap.Error(err), zap.String("id", delivery.ID))
+		}
+		return true
+	}
+
+	delivery.LastStatusCode = resp.StatusCode
+	delivery.LastResponse = string(res)
+	return s.retryOrDeadLetter(delivery)
+}
+
+// webhookTimeout is the per-request timeout, WEBHOOK_TIMEOUT unless the
+// instance overrides it.
+func webhookTimeout(instance *models.Instance) time.Duration {
+	if instance != nil && instance.Webhook.Timeout > 0 {
+		return time.Duration(instance.Webhook.Timeout) * time.Second
+	}
+
+	return env.Env.WebhookTimeout
+}
+
+// setWebhookHeaders applies the headers configured on the instance at send
+// time, so a rotated token or secret also applies to retries and replays.
+func setWebhookHeaders(req *http.Request, delivery *models.WebhookDelivery, instance *models.Instance) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+
+	if instance == nil {
+		return
+	}
+
+	headers := instance.Webhook.Headers
+	if len(headers.ContentType) > 0 {
+		req.Header.Set("Content-Type", headers.ContentType)
+	}
+	if len(headers.Authorization) > 0 {
+		req.Header.Set("Authorization", headers.Authorization)
+	}
+	if len(instance.Webhook.Secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, signWebhook(instance.Webhook.Secret, time.Now(), delivery.Payload))
+	}
+}
+
+// signWebhook returns "t=<unix>,v1=<hex>" where v1 is the HMAC-SHA256 of
+// "<unix>.<payload>". Receivers recompute it and reject stale timestamps.
+func signWebhook(secret string, at time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Whatsmiau) retryOrDeadLetter(delivery *models.WebhookDelivery) bool {
+	if delivery.MaxAttempts > 0 && delivery.Attempts >= delivery.MaxAttempts {
+		s.deadLetter(delivery)
+		return true
+	}
+
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+	defer c()
+
+	delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+	zap.L().Warn("webhook delivery failed, scheduling retry",
+		zap.String("id", delivery.ID),
+		zap.String("url", delivery.Url),
+		zap.Int("attempts", delivery.Attempts),
+		zap.Int("status", delivery.LastStatusCode),
+		zap.String("error", delivery.LastError),
+		zap.Time("next_attempt", delivery.NextAttemptAt),
+	)
+	if err := s.webhooks.Schedule(ctx, delivery); err != nil {
+		zap.L().Error("failed to schedule webhook retry", zap.Error(err), zap.String("id", delivery.ID))
+	}
+	return false
+}
+
+func (s *Whatsmiau) deadLetter(delivery *models.WebhookDelivery) {
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Second)
+	defer c()
+
+	zap.L().Error("webhook delivery failed, moving to dead-letter",
+		zap.String("id", delivery.ID),
+		zap.String("instance", delivery.InstanceID),
+		zap.String("url", delivery.Url),
+		zap.Int("attempts", delivery.Attempts),
+		zap.Int("status", delivery.LastStatusCode),
+		zap.String("error", delivery.LastError),
+	)
+	if err := s.webhooks.DeadLetter(ctx, delivery); err != nil {
+		zap.L().Error("failed to dead-letter webhook delivery", zap.Error(err), zap.String("id", delivery.ID))
+	}
+}
+
+// webhookBackoff doubles the wait on every attempt, capped at WEBHOOK_RETRY_MAX,
+// keeping half of it random so receivers coming back up are not stampeded.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := env.Env.WebhookRetryBase
+	for i := 1; i < attempts && backoff < env.Env.WebhookRetryMax; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, env.Env.WebhookRetryMax)
+	if backoff <= 0 {
+		return time.Second
+	}
+
+	half := backoff / 2
+	return half + rand.N(half+1)
+}
+
+func (s *Whatsmiau) ListWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	return s.webhooks.List(ctx, filter)
+}
+
+func (s *Whatsmiau) GetWebhookDelivery(ctx context.Context, instanceID, id string) (*models.WebhookDelivery, error) {
+	delivery, err := s.webhooks.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if delivery.InstanceID != instanceID {
+		return nil, webhooks.ErrorNotFound
+	}
+
+	return delivery, nil
+}
+
+// ReplayWebhookDelivery queues the stored payload again with a fresh attempt
+// budget; the body sent is exactly the one of the original event.
+func (s *Whatsmiau) ReplayWebhookDelivery(ctx context.Context, instanceID, id string) (*models.WebhookDelivery, error) {
+	delivery, err := s.GetWebhookDelivery(ctx, instanceID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.replay(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (s *Whatsmiau) ReplayWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	deliveries, err := s.webhooks.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		if err := s.replay(ctx, &deliveries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (s *Whatsmiau) replay(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	return s.webhooks.Schedule(ctx, delivery)
+}
+
+func (s *Whatsmiau) DeleteWebhookDelivery(ctx context.Context, instanceID, id string) error {
+	delivery, err := s.GetWebhookDelivery(ctx, instanceID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.webhooks.Delete(ctx, delivery); err != nil {
+		return err
+	}
+
+	s.dispatcher.forget(delivery)
+	return nil
+}
+
+func (s *Whatsmiau) PurgeWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (int, error) {
+	deliveries, err := s.webhooks.List(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		if err := s.webhooks.Delete(ctx, &deliveries[i]); err != nil {
+			return i, err
+		}
+		s.dispatcher.forget(&deliveries[i])
+	}
+
+	return len(deliveries), nil
+}
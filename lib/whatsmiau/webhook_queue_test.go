@@ -0,0 +1,300 @@
+package whatsmiau
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/webhooks"
+	"golang.org/x/net/context"
+)
+
+// memoryWebhooks is a WebhookRepository keeping the deliveries in a map and
+// counting the calls, Claim is not used by the tests.
+type memoryWebhooks struct {
+	mu         sync.Mutex
+	deliveries map[string]models.WebhookDelivery
+	scheduled  int
+	dead       int
+	done       int
+}
+
+func newMemoryWebhooks() *memoryWebhooks {
+	return &memoryWebhooks{deliveries: make(map[string]models.WebhookDelivery)}
+}
+
+func (m *memoryWebhooks) Schedule(_ context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery.Status = models.WebhookDeliveryPending
+	m.deliveries[delivery.ID] = *delivery
+	m.scheduled++
+	return nil
+}
+
+func (m *memoryWebhooks) Claim(context.Context, time.Time, time.Duration, int64) ([]models.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *memoryWebhooks) DeadLetter(_ context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery.Status = models.WebhookDeliveryFailed
+	m.deliveries[delivery.ID] = *delivery
+	m.dead++
+	return nil
+}
+
+func (m *memoryWebhooks) Done(_ context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.deliveries, delivery.ID)
+	m.done++
+	return nil
+}
+
+func (m *memoryWebhooks) Delete(_ context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.deliveries, delivery.ID)
+	return nil
+}
+
+func (m *memoryWebhooks) Get(_ context.Context, id string) (*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil, webhooks.ErrorNotFound
+	}
+	return &delivery, nil
+}
+
+func (m *memoryWebhooks) List(_ context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []models.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.InstanceID == filter.InstanceID && (filter.Status == "" || delivery.Status == filter.Status) {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+// testWebhookEnv sets the webhook retry settings for a test.
+func testWebhookEnv(t *testing.T, base, limit time.Duration) {
+	t.Helper()
+
+	prevBase, prevMax, prevTimeout := env.Env.WebhookRetryBase, env.Env.WebhookRetryMax, env.Env.WebhookTimeout
+	env.Env.WebhookRetryBase, env.Env.WebhookRetryMax, env.Env.WebhookTimeout = base, limit, 5*time.Second
+	t.Cleanup(func() {
+		env.Env.WebhookRetryBase, env.Env.WebhookRetryMax, env.Env.WebhookTimeout = prevBase, prevMax, prevTimeout
+	})
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	testWebhookEnv(t, 5*time.Second, time.Minute)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration // before the jitter, which keeps half of it
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{4, 40 * time.Second},
+		{5, time.Minute},
+		{50, time.Minute},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			if got := webhookBackoff(tt.attempts); got < tt.want/2 || got > tt.want {
+				t.Fatalf("webhookBackoff(%d) = %s, want between %s and %s", tt.attempts, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestWebhookBackoffWithoutBase(t *testing.T) {
+	testWebhookEnv(t, 0, 0)
+
+	if got := webhookBackoff(3); got != time.Second {
+		t.Fatalf("webhookBackoff() = %s, want 1s", got)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	testWebhookEnv(t, time.Minute, time.Hour)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("receiver says"))
+	}))
+	defer server.Close()
+
+	repo := newMemoryWebhooks()
+	s := &Whatsmiau{webhooks: repo, webhookClient: &http.Client{}}
+	delivery := &models.WebhookDelivery{ID: "d1", Url: server.URL, Payload: []byte(`{}`), MaxAttempts: 2}
+
+	status = http.StatusInternalServerError
+	if s.deliver(delivery) {
+		t.Fatal("a failed first attempt should be retried")
+	}
+	if repo.scheduled != 1 || delivery.Attempts != 1 || delivery.LastStatusCode != status || delivery.LastResponse != "receiver says" {
+		t.Fatalf("retry not scheduled as expected: %+v", delivery)
+	}
+	if wait := time.Until(delivery.NextAttemptAt); wait < 29*time.Second || wait > time.Minute {
+		t.Fatalf("next attempt in %s, want the backoff of the first attempt", wait)
+	}
+
+	if !s.deliver(delivery) {
+		t.Fatal("the last attempt should finish the delivery")
+	}
+	if repo.dead != 1 || delivery.Status != models.WebhookDeliveryFailed {
+		t.Fatalf("delivery not dead-lettered: %+v", delivery)
+	}
+
+	status = http.StatusNoContent
+	delivery = &models.WebhookDelivery{ID: "d2", Url: server.URL, Payload: []byte(`{}`), MaxAttempts: 2}
+	if !s.deliver(delivery) || repo.done != 1 {
+		t.Fatalf("a delivered webhook should be done: %+v", delivery)
+	}
+
+	for _, maxAttempts := range []int{5, 0} {
+		dead := repo.dead
+		delivery = &models.WebhookDelivery{ID: "d3", Url: "://bad", Payload: []byte(`{}`), MaxAttempts: maxAttempts}
+		if !s.deliver(delivery) || repo.dead != dead+1 {
+			t.Fatalf("a malformed url should be dead-lettered right away: %+v", delivery)
+		}
+	}
+}
+
+func TestReplayWebhookDelivery(t *testing.T) {
+	repo := newMemoryWebhooks()
+	s := &Whatsmiau{webhooks: repo}
+	s.dispatcher = newWebhookDispatcher(1, 1, s.deliver, s.postponeDelivery)
+
+	failed := &models.WebhookDelivery{ID: "d1", InstanceID: "a", Attempts: 10, MaxAttempts: 10}
+	_ = repo.DeadLetter(context.Background(), failed)
+
+	if _, err := s.ReplayWebhookDelivery(context.Background(), "b", "d1"); !errors.Is(err, webhooks.ErrorNotFound) {
+		t.Fatalf("a delivery of another instance should not be found, got %v", err)
+	}
+
+	replayed, err := s.ReplayWebhookDelivery(context.Background(), "a", "d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Attempts != 0 || replayed.Status != models.WebhookDeliveryPending || time.Since(replayed.NextAttemptAt) > time.Minute {
+		t.Fatalf("replay should queue the delivery again with a fresh budget: %+v", replayed)
+	}
+
+	stored, err := repo.Get(context.Background(), "d1")
+	if err != nil || stored.Status != models.WebhookDeliveryPending {
+		t.Fatalf("replay not stored: %+v, %v", stored, err)
+	}
+}
+
+func TestPurgeWebhookDeliveries(t *testing.T) {
+	repo := newMemoryWebhooks()
+	s := &Whatsmiau{webhooks: repo}
+	s.dispatcher = newWebhookDispatcher(1, 1, s.deliver, s.postponeDelivery)
+
+	for _, delivery := range []*models.WebhookDelivery{
+		{ID: "d1", InstanceID: "a"},
+		{ID: "d2", InstanceID: "a"},
+		{ID: "d3", InstanceID: "b"},
+	} {
+		_ = repo.DeadLetter(context.Background(), delivery)
+	}
+
+	purged, err := s.PurgeWebhookDeliveries(context.Background(), models.WebhookDeliveryFilter{InstanceID: "a", Status: models.WebhookDeliveryFailed})
+	if err != nil || purged != 2 {
+		t.Fatalf("purged %d (%v), want 2", purged, err)
+	}
+	if _, err := repo.Get(context.Background(), "d3"); err != nil {
+		t.Fatalf("the delivery of another instance should be kept: %v", err)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	payload := []byte(`{"event":"messages.upsert"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(payload)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := signWebhook("secret", at, payload); got != want {
+		t.Fatalf("signWebhook() = %s, want %s", got, want)
+	}
+	if signWebhook("other", at, payload) == want {
+		t.Fatal("the signature should depend on the secret")
+	}
+	if signWebhook("secret", at.Add(time.Second), payload) == want {
+		t.Fatal("the signature should depend on the timestamp")
+	}
+}
+
+func TestSetWebhookHeaders(t *testing.T) {
+	delivery := &models.WebhookDelivery{ID: "d1", Payload: []byte(`{}`)}
+
+	tests := []struct {
+		name     string
+		instance *models.Instance
+		want     map[string]string
+		signed   bool
+	}{
+		{
+			name: "without instance",
+			want: map[string]string{"Content-Type": "application/json", webhookDeliveryHeader: "d1"},
+		},
+		{
+			name: "configured headers",
+			instance: &models.Instance{Webhook: models.InstanceWebhook{Headers: models.InstanceWebhookHeaders{
+				Authorization: "Bearer token",
+				ContentType:   "application/vnd.custom+json",
+			}}},
+			want: map[string]string{"Content-Type": "application/vnd.custom+json", "Authorization": "Bearer token", webhookDeliveryHeader: "d1"},
+		},
+		{
+			name:     "signed",
+			instance: &models.Instance{Webhook: models.InstanceWebhook{Secret: "secret"}},
+			want:     map[string]string{"Content-Type": "application/json", webhookDeliveryHeader: "d1"},
+			signed:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://example.com", nil)
+			setWebhookHeaders(req, delivery, tt.instance)
+
+			for header, value := range tt.want {
+				if got := req.Header.Get(header); got != value {
+					t.Errorf("%s = %q, want %q", header, got, value)
+				}
+			}
+			if signature := req.Header.Get(webhookSignatureHeader); (signature != "") != tt.signed {
+				t.Errorf("%s = %q, signed %v", webhookSignatureHeader, signature, tt.signed)
+			}
+		})
+	}
+}
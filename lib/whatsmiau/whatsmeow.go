@@ -12,7 +12,8 @@ import (
 	"github.com/verbeux-ai/whatsmiau/lib/storage/gcs"
 	"github.com/verbeux-ai/whatsmiau/models"
 	"github.com/verbeux-ai/whatsmiau/repositories/instances"
-	"github.com/verbeux-ai/whatsmiau/services"
+	"github.com/verbeux-ai/whatsmiau/repositories/schedules"
+	"github.com/verbeux-ai/whatsmiau/repositories/webhooks"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
@@ -32,7 +33,22 @@ type Whatsmiau struct {
 	pairingCache     *xsync.Map[string, PairingSession]
 	pairingObserver  *xsync.Map[string, bool]
 	emitter          chan emitter
+	webhooks         interfaces.WebhookRepository
+	dispatcher       *webhookDispatcher
+	stream           *eventStream
+	connections      *connectionHub
+	supervisors      *xsync.Map[string, *supervisor]
+	unmatched        *xsync.Map[string, *whatsmeow.Client]
+	presences        *xsync.Map[string, *presenceState]
+	limiters         *xsync.Map[string, *sendLimiter]
+	sendQueues       *xsync.Map[string, chan string]
+	sendJobs         *xsync.Map[string, SendJob]
+	sent             *xsync.Map[string, *sentLog]
+	schedules        interfaces.ScheduleRepository
+	scheduled        *xsync.Map[string, bool]
+	webhookClient    *http.Client
 	httpClient       *http.Client
+	previewClient    *http.Client
 	fileStorage      interfaces.Storage
 	handlerSemaphore chan struct{}
 }
@@ -59,7 +75,7 @@ func LoadMiau(ctx context.Context, container *sqlstore.Container) {
 		level = "DEBUG"
 	}
 
-	repo := instances.NewRedis(services.Redis())
+	repo := instances.Get()
 	instanceList, err := repo.List(ctx, "")
 	if err != nil {
 		zap.L().Fatal("Failed to list instances", zap.Error(err))
@@ -74,27 +90,50 @@ func LoadMiau(ctx context.Context, container *sqlstore.Container) {
 	}
 
 	clients := xsync.NewMap[string, *whatsmeow.Client]()
+	unmatched := xsync.NewMap[string, *whatsmeow.Client]()
+
+	// an empty instance list is far more likely a flushed or wrong redis than
+	// a deployment without instances, unlinking every number would be fatal
+	logoutUnmatched := env.Env.UnmatchedDevices == UnmatchedDevicesLogout
+	if logoutUnmatched && len(instanceList) == 0 && len(deviceStore) > 0 {
+		zap.L().Error("no instances found, refusing to logout unmatched devices; check REDIS_URL",
+			zap.Int("devices", len(deviceStore)),
+		)
+		logoutUnmatched = false
+	}
+
+	// instances whose first connection failed, handed to the supervisor
+	var notConnected []string
 
 	clientLog := waLog.Stdout("Client", level, false)
 	for _, device := range deviceStore {
 		client := whatsmeow.NewClient(device, clientLog)
-		if err := client.Connect(); err != nil {
-			zap.L().Error("failed to connect connected device", zap.Error(err), zap.String("jid", client.Store.ID.String()))
+		if client.Store.ID == nil {
+			continue
 		}
 
-		if client.Store.ID == nil {
-			_ = client.Logout(context.Background())
-			client.Disconnect()
+		jid := client.Store.ID.String()
+		instanceFound, ok := instanceByRemoteJid[jid]
+		if !ok {
+			if logoutUnmatched {
+				zap.L().Warn("logging out device not matched to any instance", zap.String("jid", jid))
+				if err := client.Connect(); err == nil {
+					_ = client.Logout(context.Background())
+				}
+				client.Disconnect()
+				continue
+			}
+
+			zap.L().Warn("device not matched to any instance, quarantined", zap.String("jid", jid))
+			unmatched.Store(jid, client)
 			continue
 		}
 
-		instanceFound, ok := instanceByRemoteJid[client.Store.ID.String()]
-		if ok {
-			clients.Store(instanceFound.ID, client)
-		} else {
-			_ = client.Logout(context.Background())
-			client.Disconnect()
+		if err := client.Connect(); err != nil {
+			zap.L().Error("failed to connect connected device", zap.Error(err), zap.String("jid", jid))
+			notConnected = append(notConnected, instanceFound.ID)
 		}
+		clients.Store(instanceFound.ID, client)
 	}
 
 	var storage interfaces.Storage
@@ -116,21 +155,46 @@ func LoadMiau(ctx context.Context, container *sqlstore.Container) {
 		pairingCache:    xsync.NewMap[string, PairingSession](),
 		pairingObserver: xsync.NewMap[string, bool](),
 		emitter:         make(chan emitter, env.Env.EmitterBufferSize),
+		webhooks:        webhooks.Get(),
+		// webhook timeouts are set per request, see webhookTimeout
+		webhookClient: &http.Client{},
 		httpClient: &http.Client{
-			Timeout: time.Second * 30, // TODO: load from env
+			Timeout: time.Second * 30, // media and profile picture downloads
 		},
+		previewClient:    newLinkPreviewClient(publicIP),
 		fileStorage:      storage,
 		handlerSemaphore: make(chan struct{}, env.Env.HandlerSemaphoreSize),
 	}
+	instance.dispatcher = newWebhookDispatcher(env.Env.WebhookWorkers, env.Env.WebhookQueueSize, instance.deliver, instance.postponeDelivery)
+	instance.stream = newEventStream(env.Env.EventStreamBuffer, eventStreamQueueSize)
+	instance.connections = newConnectionHub()
+	instance.supervisors = xsync.NewMap[string, *supervisor]()
+	instance.unmatched = unmatched
+	instance.presences = xsync.NewMap[string, *presenceState]()
+	instance.limiters = xsync.NewMap[string, *sendLimiter]()
+	instance.sendQueues = xsync.NewMap[string, chan string]()
+	instance.sendJobs = xsync.NewMap[string, SendJob]()
+	instance.sent = xsync.NewMap[string, *sentLog]()
+	instance.schedules = schedules.Get()
+	instance.scheduled = xsync.NewMap[string, bool]()
 
 	go instance.startEmitter()
+	go instance.startRetrier()
+	go instance.startScheduler()
 
 	clients.Range(func(id string, client *whatsmeow.Client) bool {
 		zap.L().Info("stating event handler", zap.String("jid", client.Store.ID.String()))
 		client.AddEventHandler(instance.Handle(id))
+		instance.supervise(id, client)
 		return true
 	})
 
+	for _, id := range notConnected {
+		if client, ok := clients.Load(id); ok {
+			instance.reconnect(id, client, 0, "connect failed at startup")
+		}
+	}
+
 }
 
 func (s *Whatsmiau) Connect(ctx context.Context, id string) (string, error) {
@@ -185,30 +249,33 @@ func (s *Whatsmiau) observeConnection(client *whatsmeow.Client, id string) {
 		case <-time.After(2 * time.Minute): // QR code expiration
 			_ = client.Logout(context.Background())
 			client.Disconnect()
-			s.clients.Delete(id)
-			zap.L().Info("QR code expired, disconnected client", zap.String("id", id))
+			if s.dropClient(id, client) {
+				zap.L().Info("QR code expired, disconnected client", zap.String("id", id))
+				s.connections.publish(id, ConnectionEvent{Type: ConnectionEventClosed, Reason: "qr code expired"})
+			}
 			return
 		case evt, ok := <-qrChan:
 			if !ok { // closed qr chan
-				zap.L().Warn("QR channel closed while handling post-qr events", zap.String("id", id))
-				s.clients.Delete(id)
+				if s.dropClient(id, client) {
+					zap.L().Warn("QR channel closed while handling post-qr events", zap.String("id", id))
+					s.connections.publish(id, ConnectionEvent{Type: ConnectionEventClosed, Reason: "qr channel closed"})
+				}
 				return
 			}
 			if evt.Event == "code" {
 				s.qrCache.Store(id, evt.Code)
+				s.connections.publish(id, ConnectionEvent{Type: ConnectionEventQrCode, Code: evt.Code})
+				s.emitQrCodeUpdated(id, evt.Code, "")
 			} else {
 				zap.L().Info("device connected successfully", zap.String("id", id))
 				if client.Store.ID == nil {
-					s.clients.Delete(id)
-					zap.L().Error("jid is nil after login", zap.String("id", id))
-				} else {
-					client.RemoveEventHandlers()
-					client.AddEventHandler(s.Handle(id))
-					if _, err := s.repo.Update(context.Background(), id, &models.Instance{
-						RemoteJID: client.Store.ID.String(),
-					}); err != nil {
-						zap.L().Error("failed to update instance after login", zap.Error(err))
+					if s.dropClient(id, client) {
+						zap.L().Error("jid is nil after login", zap.String("id", id))
+						s.connections.publish(id, ConnectionEvent{Type: ConnectionEventClosed, Reason: evt.Event})
 					}
+				} else {
+					s.connections.publish(id, ConnectionEvent{Type: ConnectionEventOpen, RemoteJID: client.Store.ID.String()})
+					s.loggedIn(id, client)
 				}
 				return
 			}
@@ -216,6 +283,35 @@ func (s *Whatsmiau) observeConnection(client *whatsmeow.Client, id string) {
 	}
 }
 
+// dropClient removes the client of an instance unless it was replaced since,
+// as by an adopted device, and reports whether it did.
+func (s *Whatsmiau) dropClient(id string, client *whatsmeow.Client) bool {
+	var dropped bool
+	s.clients.Compute(id, func(current *whatsmeow.Client, loaded bool) (*whatsmeow.Client, xsync.ComputeOp) {
+		if !loaded || current != client {
+			return current, xsync.CancelOp
+		}
+		dropped = true
+		return nil, xsync.DeleteOp
+	})
+
+	return dropped
+}
+
+// loggedIn handles the events of a client that just logged in, by QR code or
+// pairing code, and binds its device to the instance.
+func (s *Whatsmiau) loggedIn(id string, client *whatsmeow.Client) {
+	client.RemoveEventHandlers()
+	client.AddEventHandler(s.Handle(id))
+	s.supervise(id, client)
+	remoteJID := client.Store.ID.String()
+	if _, err := s.repo.Update(context.Background(), id, &models.InstanceUpdate{
+		RemoteJID: &remoteJID,
+	}); err != nil {
+		zap.L().Error("failed to update instance after login", zap.Error(err))
+	}
+}
+
 func (s *Whatsmiau) observeAndQrCode(ctx context.Context, id string, client *whatsmeow.Client) (string, error) {
 	ctx, c := context.WithTimeout(ctx, 15*time.Second)
 	defer c()
@@ -248,6 +344,13 @@ func (s *Whatsmiau) Status(id string) (Status, error) {
 		return Connected, nil
 	}
 
+	if sup, ok := s.supervisors.Load(id); ok {
+		switch state := sup.status(); state {
+		case Connecting, Backoff, Failed:
+			return state, nil
+		}
+	}
+
 	// If not connected, but we have a QR code, the state is QrCode
 	if _, ok := s.qrCache.Load(id); ok && client.IsConnected() {
 		return QrCode, nil
@@ -267,6 +370,9 @@ func (s *Whatsmiau) Logout(ctx context.Context, id string) error {
 		return nil
 	}
 
+	s.stopSupervisor(id)
+	s.stopPresence(id)
+
 	return client.Logout(ctx)
 }
 
@@ -277,6 +383,9 @@ func (s *Whatsmiau) Disconnect(id string) error {
 		return nil
 	}
 
+	s.stopSupervisor(id)
+	s.stopPresence(id)
+
 	client.Disconnect()
 
 	s.clients.Delete(id)
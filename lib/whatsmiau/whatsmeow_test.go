@@ -0,0 +1,31 @@
+package whatsmiau
+
+import (
+	"testing"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"go.mau.fi/whatsmeow"
+)
+
+func TestDropClient(t *testing.T) {
+	s := &Whatsmiau{clients: xsync.NewMap[string, *whatsmeow.Client]()}
+	pairing, adopted := &whatsmeow.Client{}, &whatsmeow.Client{}
+
+	s.clients.Store("a", adopted)
+	if s.dropClient("a", pairing) {
+		t.Fatal("a replaced client should not be dropped")
+	}
+	if current, ok := s.clients.Load("a"); !ok || current != adopted {
+		t.Fatal("the adopted client should be kept")
+	}
+
+	if !s.dropClient("a", adopted) {
+		t.Fatal("the stored client should be dropped")
+	}
+	if _, ok := s.clients.Load("a"); ok {
+		t.Fatal("the client is still stored")
+	}
+	if s.dropClient("a", adopted) {
+		t.Fatal("nothing is stored to drop")
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// API key scopes, admin grants all of them.
+const (
+	ScopeRead  = "read"
+	ScopeSend  = "send"
+	ScopeAdmin = "admin"
+)
+
+var Scopes = []string{ScopeRead, ScopeSend, ScopeAdmin}
+
+// InstanceScopes are granted to the token created along with an instance.
+var InstanceScopes = []string{ScopeRead, ScopeSend}
+
+type ApiKey struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	Hash       string    `json:"hash"`                 // sha256 of the key, which is only known when it is created
+	InstanceID string    `json:"instanceId,omitempty"` // the only instance the key can access, empty for every instance
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Allows reports whether the key grants scope. Keys restricted to an instance
+// never get admin, which manages the instance itself.
+func (k *ApiKey) Allows(scope string) bool {
+	if k.InstanceID != "" {
+		return scope != ScopeAdmin && slices.Contains(k.Scopes, scope)
+	}
+
+	return slices.Contains(k.Scopes, ScopeAdmin) || slices.Contains(k.Scopes, scope)
+}
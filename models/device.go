@@ -0,0 +1,11 @@
+package models
+
+// UnmatchedDevice is a linked device from the session store whose JID is not
+// the remoteJid of any instance.
+type UnmatchedDevice struct {
+	JID          string `json:"jid"`
+	LID          string `json:"lid,omitempty"`
+	PushName     string `json:"pushName,omitempty"`
+	BusinessName string `json:"businessName,omitempty"`
+	Platform     string `json:"platform,omitempty"`
+}
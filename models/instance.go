@@ -1,30 +1,157 @@
 package models
 
+import "strings"
+
 type Instance struct {
-	ID                string          `json:"id,omitempty"`
-	RejectCall        bool            `json:"rejectCall,omitempty"`
-	MsgCall           string          `json:"msgCall,omitempty"`
-	GroupsIgnore      bool            `json:"groupsIgnore,omitempty"`
-	AlwaysOnline      bool            `json:"alwaysOnline,omitempty"`
-	ReadMessages      bool            `json:"readMessages,omitempty"`
-	ReadStatus        bool            `json:"readStatus,omitempty"`
-	SyncFullHistory   bool            `json:"syncFullHistory,omitempty"`
-	SyncRecentHistory bool            `json:"syncRecentHistory,omitempty"`
-	RemoteJID         string          `json:"remoteJID,omitempty"`
-	Webhook           InstanceWebhook `json:"webhook,omitempty"`
-	AutoReadMessages  bool            `json:"autoReadMessages,omitempty"`
-	ReadDelay         int             `json:"readDelay,omitempty"`
+	ID                string             `json:"id,omitempty"`
+	RejectCall        bool               `json:"rejectCall,omitempty"`
+	MsgCall           string             `json:"msgCall,omitempty"`
+	GroupsIgnore      bool               `json:"groupsIgnore,omitempty"`
+	AlwaysOnline      bool               `json:"alwaysOnline,omitempty"`
+	ReadMessages      bool               `json:"readMessages,omitempty"`
+	ReadStatus        bool               `json:"readStatus,omitempty"`
+	SyncFullHistory   bool               `json:"syncFullHistory,omitempty"`
+	SyncRecentHistory bool               `json:"syncRecentHistory,omitempty"`
+	RemoteJID         string             `json:"remoteJID,omitempty"`
+	Webhook           InstanceWebhook    `json:"webhook,omitempty"`
+	AutoReadMessages  bool               `json:"autoReadMessages,omitempty"`
+	ReadDelay         int                `json:"readDelay,omitempty"`
+	Tags              []string           `json:"tags,omitempty"`     // free-form labels instances can be listed by
+	Metadata          map[string]string  `json:"metadata,omitempty"` // free-form values sent along with every event
+	SendLimits        InstanceSendLimits `json:"sendLimits,omitempty"`
+}
+
+// InstanceSendLimits overrides the SEND_* limits, 0 keeps the default and a
+// negative value disables the limit.
+type InstanceSendLimits struct {
+	Rate             float64 `json:"rate,omitempty"` // per minute
+	Burst            int     `json:"burst,omitempty"`
+	RecipientRate    float64 `json:"recipientRate,omitempty"` // per minute
+	RecipientBurst   int     `json:"recipientBurst,omitempty"`
+	DailyNewContacts int     `json:"dailyNewContacts,omitempty"`
 }
 
 type InstanceWebhook struct {
-	Url      string                 `json:"url,omitempty"`
-	ByEvents bool                   `json:"byEvents,omitempty"`
-	Base64   *bool                  `json:"base64,omitempty"`
-	Headers  InstanceWebhookHeaders `json:"headers,omitempty"`
-	Events   []string               `json:"events,omitempty"`
+	Url         string                 `json:"url,omitempty"`
+	ByEvents    bool                   `json:"byEvents,omitempty"`
+	Base64      *bool                  `json:"base64,omitempty"`
+	Headers     InstanceWebhookHeaders `json:"headers,omitempty"`
+	Events      []string               `json:"events,omitempty"`
+	MaxAttempts int                    `json:"maxAttempts,omitempty"` // delivery attempts before dead-lettering, 0 uses WEBHOOK_MAX_ATTEMPTS
+	Secret      string                 `json:"secret,omitempty"`      // signs deliveries with X-Whatsmiau-Signature when set
+	EventUrls   map[string]string      `json:"eventUrls,omitempty"`   // per event url override, keyed by MESSAGES_UPSERT or messages.upsert
+	Timeout     int                    `json:"timeout,omitempty"`     // seconds, overrides WEBHOOK_TIMEOUT
 }
 
 type InstanceWebhookHeaders struct {
 	Authorization string `json:"authorization,omitempty"`
 	ContentType   string `json:"Content-Type,omitempty"` // Following EvolutionAPI Pattern
 }
+
+// InstanceUpdate is a partial update of an Instance: nil fields are left
+// untouched, so a zero value can still be set explicitly.
+type InstanceUpdate struct {
+	RejectCall        *bool                  `json:"rejectCall,omitempty"`
+	MsgCall           *string                `json:"msgCall,omitempty"`
+	GroupsIgnore      *bool                  `json:"groupsIgnore,omitempty"`
+	AlwaysOnline      *bool                  `json:"alwaysOnline,omitempty"`
+	ReadMessages      *bool                  `json:"readMessages,omitempty"`
+	ReadStatus        *bool                  `json:"readStatus,omitempty"`
+	SyncFullHistory   *bool                  `json:"syncFullHistory,omitempty"`
+	SyncRecentHistory *bool                  `json:"syncRecentHistory,omitempty"`
+	RemoteJID         *string                `json:"-"` // only set by the login, it binds the stored device to the instance
+	Webhook           *InstanceWebhookUpdate `json:"webhook,omitempty"`
+	AutoReadMessages  *bool                  `json:"autoReadMessages,omitempty"`
+	ReadDelay         *int                   `json:"readDelay,omitempty"`
+	Tags              *[]string              `json:"tags,omitempty"`
+	Metadata          *map[string]string     `json:"metadata,omitempty"`
+	SendLimits        *InstanceSendLimits    `json:"sendLimits,omitempty"`
+}
+
+type InstanceWebhookUpdate struct {
+	Url         *string                 `json:"url,omitempty"`
+	ByEvents    *bool                   `json:"byEvents,omitempty"`
+	Base64      *bool                   `json:"base64,omitempty"`
+	Headers     *InstanceWebhookHeaders `json:"headers,omitempty"`
+	Events      *[]string               `json:"events,omitempty"`
+	MaxAttempts *int                    `json:"maxAttempts,omitempty"`
+	Secret      *string                 `json:"secret,omitempty"`
+	EventUrls   *map[string]string      `json:"eventUrls,omitempty"`
+	Timeout     *int                    `json:"timeout,omitempty"`
+}
+
+// Apply sets every non-nil field of the update on instance.
+func (u *InstanceUpdate) Apply(instance *Instance) {
+	set(&instance.RejectCall, u.RejectCall)
+	set(&instance.MsgCall, u.MsgCall)
+	set(&instance.GroupsIgnore, u.GroupsIgnore)
+	set(&instance.AlwaysOnline, u.AlwaysOnline)
+	set(&instance.ReadMessages, u.ReadMessages)
+	set(&instance.ReadStatus, u.ReadStatus)
+	set(&instance.SyncFullHistory, u.SyncFullHistory)
+	set(&instance.SyncRecentHistory, u.SyncRecentHistory)
+	set(&instance.RemoteJID, u.RemoteJID)
+	set(&instance.AutoReadMessages, u.AutoReadMessages)
+	set(&instance.ReadDelay, u.ReadDelay)
+	set(&instance.Metadata, u.Metadata)
+	set(&instance.SendLimits, u.SendLimits)
+	if u.Tags != nil {
+		instance.Tags = NormalizeTags(*u.Tags)
+	}
+
+	if u.Webhook == nil {
+		return
+	}
+
+	webhook := &instance.Webhook
+	set(&webhook.Url, u.Webhook.Url)
+	set(&webhook.ByEvents, u.Webhook.ByEvents)
+	set(&webhook.Headers, u.Webhook.Headers)
+	set(&webhook.Events, u.Webhook.Events)
+	set(&webhook.MaxAttempts, u.Webhook.MaxAttempts)
+	set(&webhook.Secret, u.Webhook.Secret)
+	set(&webhook.EventUrls, u.Webhook.EventUrls)
+	set(&webhook.Timeout, u.Webhook.Timeout)
+	if u.Webhook.Base64 != nil {
+		webhook.Base64 = u.Webhook.Base64
+	}
+}
+
+// NormalizeTags trims the tags and drops empty and repeated ones.
+func NormalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+func set[T any](field *T, value *T) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// InstanceFilter narrows an instance search. Results are ordered by ID and
+// After is the last ID of the previous page.
+type InstanceFilter struct {
+	After    string
+	Limit    int                 // 0 returns every match
+	OwnerJID string              // phone number or JID, the device part is ignored
+	Match    func(Instance) bool // checked after loading, for conditions the store does not know like the connection status
+	Tag      string              // only instances having this tag
+	Count    bool                // also count every match, regardless of After and Limit
+}
+
+type InstancePage struct {
+	Instances []Instance
+	Next      string // After of the next page, empty on the last one
+	Total     int    // only set when Count is requested
+}
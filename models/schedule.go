@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledMessagePending ScheduledMessageStatus = "pending"
+	ScheduledMessageSent    ScheduledMessageStatus = "sent"
+	ScheduledMessageFailed  ScheduledMessageStatus = "failed"
+)
+
+// Message types that can be scheduled, one per send method.
+const (
+	ScheduledText     = "text"
+	ScheduledAudio    = "audio"
+	ScheduledDocument = "document"
+	ScheduledImage    = "image"
+	ScheduledVideo    = "video"
+)
+
+// What happens to a message whose instance is offline when it is due.
+const (
+	OfflinePolicyWait = "wait" // sent once the instance connects, up to SCHEDULE_MAX_DELAY late
+	OfflinePolicyFail = "fail" // failed right away
+)
+
+// ScheduledMessage is a send stored to be made at SendAt. Media holds the URL
+// of the file, which is only downloaded when the message is sent.
+type ScheduledMessage struct {
+	ID            string                 `json:"id"`
+	InstanceID    string                 `json:"instanceId"`
+	RemoteJID     string                 `json:"remoteJid"`
+	Type          string                 `json:"type"`
+	Text          string                 `json:"text,omitempty"`
+	Media         string                 `json:"media,omitempty"`
+	Caption       string                 `json:"caption,omitempty"`
+	FileName      string                 `json:"fileName,omitempty"`
+	Mimetype      string                 `json:"mimetype,omitempty"`
+	ViewOnce      bool                   `json:"viewOnce,omitempty"`
+	SendAt        time.Time              `json:"sendAt"`
+	OfflinePolicy string                 `json:"offlinePolicy"`
+	Status        ScheduledMessageStatus `json:"status"`
+	MessageID     string                 `json:"messageId,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	CreatedAt     time.Time              `json:"createdAt"`
+	UpdatedAt     time.Time              `json:"updatedAt"`
+}
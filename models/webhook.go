@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending"
+	WebhookDeliveryFailed  WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a persisted webhook request. Payload holds the exact bytes
+// that are POSTed to Url, so retries are byte-identical to the first attempt.
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	InstanceID     string                `json:"instanceId"`
+	Event          string                `json:"event"`
+	Url            string                `json:"url"`
+	ChatKey        string                `json:"chatKey,omitempty"` // deliveries sharing a chat key are sent in order
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	MaxAttempts    int                   `json:"maxAttempts"`
+	LastStatusCode int                   `json:"lastStatusCode,omitempty"`
+	LastResponse   string                `json:"lastResponse,omitempty"`
+	LastError      string                `json:"lastError,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	LastAttemptAt  time.Time             `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt  time.Time             `json:"nextAttemptAt,omitempty"`
+}
+
+type WebhookDeliveryFilter struct {
+	InstanceID string
+	Status     WebhookDeliveryStatus // empty means any status
+	From       time.Time             // zero means no lower bound
+	To         time.Time             // zero means no upper bound
+	Limit      int64                 // zero means no limit
+}
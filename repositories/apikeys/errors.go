@@ -0,0 +1,9 @@
+package apikeys
+
+import "errors"
+
+var (
+	ErrorNotFound      = errors.New("not found")
+	ErrorAlreadyExists = errors.New("api key already exists")
+	ErrKeyIDEmpty      = errors.New("api key id cannot be empty")
+)
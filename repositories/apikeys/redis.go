@@ -0,0 +1,157 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+// These verify if RedisApiKey follows apikeys interface pattern
+var _ interfaces.ApiKeyRepository = (*RedisApiKey)(nil)
+
+// indexKey is a set of every key ID.
+const indexKey = "apikeys"
+
+type RedisApiKey struct {
+	db *redis.Client
+}
+
+func NewRedis(client *redis.Client) *RedisApiKey {
+	return &RedisApiKey{
+		db: client,
+	}
+}
+
+func (s *RedisApiKey) key(id string) string {
+	return fmt.Sprintf("apikey_%s", id)
+}
+
+// instanceKey is a set of the IDs of the keys bound to an instance.
+func (s *RedisApiKey) instanceKey(instanceID string) string {
+	return fmt.Sprintf("apikeys_instance_%s", instanceID)
+}
+
+func (s *RedisApiKey) Create(ctx context.Context, key *models.ApiKey) error {
+	if key.ID == "" {
+		return ErrKeyIDEmpty
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	created, err := s.db.SetNX(ctx, s.key(key.ID), data, 0).Result()
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		return ErrorAlreadyExists
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, indexKey, key.ID)
+		if key.InstanceID != "" {
+			pipe.SAdd(ctx, s.instanceKey(key.InstanceID), key.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisApiKey) Get(ctx context.Context, id string) (*models.ApiKey, error) {
+	keys, err := s.get(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &keys[0], nil
+}
+
+func (s *RedisApiKey) List(ctx context.Context, instanceID string) ([]models.ApiKey, error) {
+	set := indexKey
+	if instanceID != "" {
+		set = s.instanceKey(instanceID)
+	}
+
+	ids, err := s.db.SMembers(ctx, set).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.get(ctx, ids)
+}
+
+func (s *RedisApiKey) get(ctx context.Context, ids []string) ([]models.ApiKey, error) {
+	result := []models.ApiKey{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+
+	rawVals, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, raw := range rawVals {
+		strVal, ok := raw.(string)
+		if !ok {
+			continue
+		}
+		var key models.ApiKey
+		if err := json.Unmarshal([]byte(strVal), &key); err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+
+	return result, nil
+}
+
+func (s *RedisApiKey) Delete(ctx context.Context, id string) error {
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.key(id))
+		pipe.SRem(ctx, indexKey, id)
+		if key.InstanceID != "" {
+			pipe.SRem(ctx, s.instanceKey(key.InstanceID), id)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisApiKey) DeleteByInstance(ctx context.Context, instanceID string) error {
+	ids, err := s.db.SMembers(ctx, s.instanceKey(instanceID)).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, s.key(id))
+			pipe.SRem(ctx, indexKey, id)
+		}
+		pipe.Del(ctx, s.instanceKey(instanceID))
+		return nil
+	})
+	return err
+}
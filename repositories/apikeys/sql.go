@@ -0,0 +1,132 @@
+package apikeys
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/migrations"
+	"golang.org/x/net/context"
+)
+
+// These verify if SQLApiKey follows apikeys interface pattern
+var _ interfaces.ApiKeyRepository = (*SQLApiKey)(nil)
+
+var schema = []migrations.Migration{
+	migrations.Exec(`CREATE TABLE IF NOT EXISTS whatsmiau_apikeys (
+		id          TEXT PRIMARY KEY,
+		instance_id TEXT NOT NULL DEFAULT '',
+		data        TEXT NOT NULL,
+		created_at  BIGINT NOT NULL
+	)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_apikeys_instance_id ON whatsmiau_apikeys (instance_id)`),
+}
+
+type SQLApiKey struct {
+	db *sql.DB
+}
+
+// NewSQL returns a repository on db, creating or upgrading its tables.
+func NewSQL(ctx context.Context, db *sql.DB) (*SQLApiKey, error) {
+	if err := migrations.Apply(ctx, db, "whatsmiau_apikeys", schema); err != nil {
+		return nil, fmt.Errorf("failed to migrate api keys: %w", err)
+	}
+
+	return &SQLApiKey{
+		db: db,
+	}, nil
+}
+
+func (s *SQLApiKey) Create(ctx context.Context, key *models.ApiKey) error {
+	if key.ID == "" {
+		return ErrKeyIDEmpty
+	}
+
+	if _, err := s.Get(ctx, key.ID); err == nil {
+		return ErrorAlreadyExists
+	} else if !errors.Is(err, ErrorNotFound) {
+		return err
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO whatsmiau_apikeys (id, instance_id, data, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		key.ID, key.InstanceID, string(data), key.CreatedAt.UnixMilli())
+	return err
+}
+
+func (s *SQLApiKey) Get(ctx context.Context, id string) (*models.ApiKey, error) {
+	keys, err := s.query(ctx, `SELECT data FROM whatsmiau_apikeys WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &keys[0], nil
+}
+
+func (s *SQLApiKey) List(ctx context.Context, instanceID string) ([]models.ApiKey, error) {
+	if instanceID != "" {
+		return s.query(ctx, `SELECT data FROM whatsmiau_apikeys WHERE instance_id = $1 ORDER BY created_at`, instanceID)
+	}
+
+	return s.query(ctx, `SELECT data FROM whatsmiau_apikeys ORDER BY created_at`)
+}
+
+func (s *SQLApiKey) query(ctx context.Context, query string, args ...any) ([]models.ApiKey, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.ApiKey{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+
+		var key models.ApiKey
+		if err := json.Unmarshal([]byte(raw), &key); err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLApiKey) Delete(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM whatsmiau_apikeys WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLApiKey) DeleteByInstance(ctx context.Context, instanceID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM whatsmiau_apikeys WHERE instance_id = $1`, instanceID)
+	return err
+}
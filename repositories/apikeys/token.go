@@ -0,0 +1,66 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+const tokenPrefix = "wm_"
+
+// New builds a key from token, or from a random one when token is empty, and
+// returns it along with the token. Only the hash is kept, so the token has to
+// be shown to the user right away.
+func New(token, name, instanceID string, scopes []string) (*models.ApiKey, string, error) {
+	if token == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, "", err
+		}
+		token = tokenPrefix + base64.RawURLEncoding.EncodeToString(random)
+	}
+
+	hash := Hash(token)
+	return &models.ApiKey{
+		ID:         idOf(hash),
+		Name:       name,
+		Hash:       hash,
+		InstanceID: instanceID,
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}, token, nil
+}
+
+// Hash is the stored form of a token. Tokens are random, so a plain sha256 is
+// enough and lets them be looked up.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the key of token, or ErrorNotFound.
+func Lookup(ctx context.Context, repo interfaces.ApiKeyRepository, token string) (*models.ApiKey, error) {
+	hash := Hash(token)
+	key, err := repo.Get(ctx, idOf(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) != 1 {
+		return nil, ErrorNotFound
+	}
+
+	return key, nil
+}
+
+// idOf derives the public ID of a key from its hash.
+func idOf(hash string) string {
+	return hash[:16]
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/verbeux-ai/whatsmiau/interfaces"
 	"github.com/verbeux-ai/whatsmiau/models"
+	"go.uber.org/zap"
 	"golang.org/x/net/context"
 )
 
@@ -17,6 +20,14 @@ var _ interfaces.InstanceRepository = (*RedisInstance)(nil)
 var ErrorNotFound = errors.New("not found")
 var ErrorAlreadyExists = errors.New("instance already exists")
 
+// indexKey is a sorted set of every instance ID, all with score 0 so that
+// they can be paged by ID with ZRANGEBYLEX.
+const indexKey = "instances"
+
+// indexedKey is set once EnsureIndex has gone through every instance, so an
+// index left partial by an interrupted run is built again.
+const indexedKey = "instances_indexed"
+
 type RedisInstance struct {
 	db *redis.Client
 }
@@ -25,34 +36,126 @@ func (s *RedisInstance) key(id string) string {
 	return fmt.Sprintf("instance_%s", id)
 }
 
+// ownerKey is a set of the IDs of the instances logged in with a number.
+func (s *RedisInstance) ownerKey(owner string) string {
+	return fmt.Sprintf("instances_owner_%s", owner)
+}
+
+// tagKey is a set of the IDs of the instances having a tag.
+func (s *RedisInstance) tagKey(tag string) string {
+	return fmt.Sprintf("instances_tag_%s", tag)
+}
+
+// lookupKeys are the sets intersected to answer a lookup.
+func (s *RedisInstance) lookupKeys(by lookup) []string {
+	var keys []string
+	if by.owner != "" {
+		keys = append(keys, s.ownerKey(by.owner))
+	}
+	if by.tag != "" {
+		keys = append(keys, s.tagKey(by.tag))
+	}
+	return keys
+}
+
 func NewRedis(client *redis.Client) *RedisInstance {
 	return &RedisInstance{
 		db: client,
 	}
 }
 
+// EnsureIndex builds the indexes of the instances created before they
+// existed. It does nothing once a build has completed.
+func (s *RedisInstance) EnsureIndex(ctx context.Context) error {
+	exists, err := s.db.Exists(ctx, indexedKey).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	var cursor uint64
+	for {
+		keys, newCursor, err := s.db.Scan(ctx, cursor, "instance_*", 100).Result()
+		if err != nil {
+			return err
+		}
+
+		instances, err := s.get(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, instance := range instances {
+				s.index(ctx, pipe, &instance)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		cursor = newCursor
+		if cursor == 0 {
+			return s.db.Set(ctx, indexedKey, 1, 0).Err()
+		}
+	}
+}
+
+func (s *RedisInstance) index(ctx context.Context, pipe redis.Pipeliner, instance *models.Instance) {
+	pipe.ZAdd(ctx, indexKey, &redis.Z{Member: instance.ID})
+	if owner := ownerJID(instance.RemoteJID); owner != "" {
+		pipe.SAdd(ctx, s.ownerKey(owner), instance.ID)
+	}
+	for _, tag := range instance.Tags {
+		pipe.SAdd(ctx, s.tagKey(tag), instance.ID)
+	}
+}
+
+// unindex removes the instance from the owner and tag sets it is no longer in
+// after being changed to current; a nil current removes it from all of them.
+func (s *RedisInstance) unindex(ctx context.Context, pipe redis.Pipeliner, old, current *models.Instance) {
+	if current == nil {
+		current = &models.Instance{}
+		pipe.ZRem(ctx, indexKey, old.ID)
+	}
+
+	if owner := ownerJID(old.RemoteJID); owner != "" && owner != ownerJID(current.RemoteJID) {
+		pipe.SRem(ctx, s.ownerKey(owner), old.ID)
+	}
+
+	for _, tag := range old.Tags {
+		if !slices.Contains(current.Tags, tag) {
+			pipe.SRem(ctx, s.tagKey(tag), old.ID)
+		}
+	}
+}
+
 func (s *RedisInstance) Create(ctx context.Context, instance *models.Instance) error {
 	if instance.ID == "" {
 		return ErrInstanceIDEmpty
 	}
 
-	result, err := s.List(ctx, instance.ID)
+	data, err := json.Marshal(instance)
 	if err != nil {
 		return err
 	}
 
-	if len(result) > 0 {
-		return ErrorAlreadyExists
-	}
-
-	data, err := json.Marshal(instance)
+	created, err := s.db.SetNX(ctx, s.key(instance.ID), data, 0).Result()
 	if err != nil {
 		return err
 	}
-	return s.db.Set(ctx, s.key(instance.ID), data, redis.KeepTTL).Err()
+
+	if !created {
+		return ErrorAlreadyExists
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		s.index(ctx, pipe, instance)
+		return nil
+	})
+	return err
 }
 
-func (s *RedisInstance) Update(ctx context.Context, id string, toUpdate *models.Instance) (*models.Instance, error) {
+func (s *RedisInstance) Update(ctx context.Context, id string, toUpdate *models.InstanceUpdate) (*models.Instance, error) {
 	if id == "" {
 		return nil, ErrInstanceIDEmpty
 	}
@@ -66,47 +169,108 @@ func (s *RedisInstance) Update(ctx context.Context, id string, toUpdate *models.
 		return nil, ErrorNotFound
 	}
 
+	previous := result[0]
 	oldInstance := result[0]
-	if len(toUpdate.RemoteJID) > 0 {
-		oldInstance.RemoteJID = toUpdate.RemoteJID
-	}
-	if toUpdate.Webhook.Base64 != nil {
-		oldInstance.Webhook.Base64 = toUpdate.Webhook.Base64
-	}
+	toUpdate.Apply(&oldInstance)
 
 	data, err := json.Marshal(oldInstance)
 	if err != nil {
 		return nil, err
 	}
 
-	return &oldInstance, s.db.Set(ctx, s.key(id), data, redis.KeepTTL).Err()
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key(id), data, redis.KeepTTL)
+		s.unindex(ctx, pipe, &previous, &oldInstance)
+		s.index(ctx, pipe, &oldInstance)
+		return nil
+	})
+
+	return &oldInstance, err
 }
 
 func (s *RedisInstance) List(ctx context.Context, id string) ([]models.Instance, error) {
-	var (
-		cursor uint64
-		keys   []string
-	)
-
-	pattern := "instance_"
 	if len(id) > 0 {
-		pattern = fmt.Sprintf("instance_%s", id)
-	} else {
-		pattern += "*"
+		return s.get(ctx, []string{s.key(id)})
 	}
 
-	for {
-		batch, newCursor, err := s.db.Scan(ctx, cursor, pattern, 100).Result()
+	page, err := s.Search(ctx, &models.InstanceFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Instances, nil
+}
+
+func (s *RedisInstance) Search(ctx context.Context, filter *models.InstanceFilter) (*models.InstancePage, error) {
+	return search(ctx, filter, s.page, s.count)
+}
+
+func (s *RedisInstance) page(ctx context.Context, after string, by lookup, n int) ([]models.Instance, string, bool, error) {
+	var ids []string
+	if sets := s.lookupKeys(by); len(sets) == 0 {
+		start := "-"
+		if after != "" {
+			start = "(" + after
+		}
+
+		result, err := s.db.ZRangeByLex(ctx, indexKey, &redis.ZRangeBy{
+			Min:   start,
+			Max:   "+",
+			Count: int64(n),
+		}).Result()
 		if err != nil {
-			return nil, err
+			return nil, "", false, err
 		}
-		keys = append(keys, batch...)
-		cursor = newCursor
-		if cursor == 0 {
-			break
+		ids = result
+	} else {
+		// owners and tags have far fewer instances, page them in memory
+		members, err := s.db.SInter(ctx, sets...).Result()
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		sort.Strings(members)
+		for _, member := range members {
+			if member > after && len(ids) < n {
+				ids = append(ids, member)
+			}
 		}
 	}
 
+	if len(ids) == 0 {
+		return nil, "", true, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+
+	instances, err := s.get(ctx, keys)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	return instances, ids[len(ids)-1], len(ids) < n, nil
+}
+
+func (s *RedisInstance) count(ctx context.Context, by lookup) (int, error) {
+	sets := s.lookupKeys(by)
+	switch len(sets) {
+	case 0:
+		total, err := s.db.ZCard(ctx, indexKey).Result()
+		return int(total), err
+	case 1:
+		total, err := s.db.SCard(ctx, sets[0]).Result()
+		return int(total), err
+	}
+
+	members, err := s.db.SInter(ctx, sets...).Result()
+	return len(members), err
+}
+
+// get loads the given keys, skipping missing ones.
+func (s *RedisInstance) get(ctx context.Context, keys []string) ([]models.Instance, error) {
 	if len(keys) == 0 {
 		return []models.Instance{}, nil
 	}
@@ -116,17 +280,15 @@ func (s *RedisInstance) List(ctx context.Context, id string) ([]models.Instance,
 		return nil, err
 	}
 
-	var instances []models.Instance
-	for _, raw := range rawVals {
-		if raw == nil {
-			continue
-		}
+	instances := make([]models.Instance, 0, len(rawVals))
+	for i, raw := range rawVals {
 		strVal, ok := raw.(string)
 		if !ok {
 			continue
 		}
 		var inst models.Instance
 		if err := json.Unmarshal([]byte(strVal), &inst); err != nil {
+			zap.L().Warn("skipping malformed instance", zap.String("key", keys[i]), zap.Error(err))
 			continue
 		}
 		instances = append(instances, inst)
@@ -149,5 +311,10 @@ func (s *RedisInstance) Delete(ctx context.Context, id string) error {
 		return ErrorNotFound
 	}
 
-	return s.db.Del(ctx, s.key(id)).Err()
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.key(id))
+		s.unindex(ctx, pipe, &result[0], nil)
+		return nil
+	})
+	return err
 }
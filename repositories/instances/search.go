@@ -0,0 +1,110 @@
+package instances
+
+import (
+	"strings"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/net/context"
+)
+
+const searchBatch = 100
+
+// lookup is the part of a filter answered by the store indexes.
+type lookup struct {
+	owner string
+	tag   string
+}
+
+// pager loads the next instances ordered by ID after the given one, optionally
+// narrowed by a lookup. last is the last ID read, even if its instance was
+// skipped, and done reports there is nothing after it.
+type pager func(ctx context.Context, after string, by lookup, n int) (result []models.Instance, last string, done bool, err error)
+
+// counter counts the instances matching a lookup.
+type counter func(ctx context.Context, by lookup) (int, error)
+
+// search implements InstanceRepository.Search on top of the store indexes.
+func search(ctx context.Context, filter *models.InstanceFilter, load pager, count counter) (*models.InstancePage, error) {
+	by := lookup{
+		owner: ownerJID(filter.OwnerJID),
+		tag:   strings.TrimSpace(filter.Tag),
+	}
+	page := &models.InstancePage{
+		Instances: []models.Instance{},
+	}
+
+	err := walk(ctx, filter.After, by, load, func(instance models.Instance) bool {
+		if filter.Match != nil && !filter.Match(instance) {
+			return true
+		}
+
+		if filter.Limit > 0 && len(page.Instances) == filter.Limit {
+			page.Next = page.Instances[len(page.Instances)-1].ID
+			return false
+		}
+
+		page.Instances = append(page.Instances, instance)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !filter.Count {
+		return page, nil
+	}
+
+	if filter.Match == nil {
+		page.Total, err = count(ctx, by)
+		return page, err
+	}
+
+	err = walk(ctx, "", by, load, func(instance models.Instance) bool {
+		if filter.Match(instance) {
+			page.Total++
+		}
+		return true
+	})
+	return page, err
+}
+
+// walk calls fn for every instance after the given ID until it returns false.
+func walk(ctx context.Context, after string, by lookup, load pager, fn func(models.Instance) bool) error {
+	for {
+		batch, last, done, err := load(ctx, after, by, searchBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range batch {
+			if !fn(instance) {
+				return nil
+			}
+		}
+
+		if done {
+			return nil
+		}
+		after = last
+	}
+}
+
+// ownerJID normalizes a phone number or a (device) JID to the user JID the
+// owner indexes are keyed by.
+func ownerJID(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if !strings.Contains(value, "@") {
+		value = strings.TrimPrefix(value, "+") + "@" + types.DefaultUserServer
+	}
+
+	jid, err := types.ParseJID(value)
+	if err != nil {
+		return value
+	}
+
+	return jid.ToNonAD().String()
+}
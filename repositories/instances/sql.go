@@ -0,0 +1,313 @@
+package instances
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/migrations"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// These verify if SQLInstance follows instances interface pattern
+var _ interfaces.InstanceRepository = (*SQLInstance)(nil)
+
+// The instance is stored as JSON so new fields need no migration; only the
+// columns used to look instances up are kept apart.
+var schema = []migrations.Migration{
+	migrations.Exec(`CREATE TABLE IF NOT EXISTS whatsmiau_instances (
+		id         TEXT PRIMARY KEY,
+		remote_jid TEXT NOT NULL DEFAULT '',
+		data       TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_instances_remote_jid ON whatsmiau_instances (remote_jid)`),
+	migrations.Exec(`ALTER TABLE whatsmiau_instances ADD COLUMN owner_jid TEXT NOT NULL DEFAULT ''`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_instances_owner_jid ON whatsmiau_instances (owner_jid, id)`),
+	fillOwnerJID,
+	migrations.Exec(`CREATE TABLE IF NOT EXISTS whatsmiau_instance_tags (
+		instance_id TEXT NOT NULL,
+		tag         TEXT NOT NULL,
+		PRIMARY KEY (instance_id, tag)
+	)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_instance_tags_tag ON whatsmiau_instance_tags (tag, instance_id)`),
+}
+
+func fillOwnerJID(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, remote_jid FROM whatsmiau_instances WHERE remote_jid <> ''`)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]string)
+	for rows.Next() {
+		var id, remoteJID string
+		if err := rows.Scan(&id, &remoteJID); err != nil {
+			rows.Close()
+			return err
+		}
+		owners[id] = ownerJID(remoteJID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, owner := range owners {
+		if _, err := tx.ExecContext(ctx, `UPDATE whatsmiau_instances SET owner_jid = $1 WHERE id = $2`, owner, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type SQLInstance struct {
+	db *sql.DB
+}
+
+// NewSQL returns a repository on db, creating or upgrading its tables. Both
+// sqlite3 and postgres accept the $n placeholders used here.
+func NewSQL(ctx context.Context, db *sql.DB) (*SQLInstance, error) {
+	repo := &SQLInstance{
+		db: db,
+	}
+
+	if err := migrations.Apply(ctx, db, "whatsmiau_instances", schema); err != nil {
+		return nil, fmt.Errorf("failed to migrate instances: %w", err)
+	}
+
+	return repo, nil
+}
+
+func (s *SQLInstance) Create(ctx context.Context, instance *models.Instance) error {
+	if instance.ID == "" {
+		return ErrInstanceIDEmpty
+	}
+
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the conflict is the duplicate check, so concurrent creates can't both pass it
+	now := time.Now().UnixMilli()
+	inserted, err := tx.ExecContext(ctx, `
+		INSERT INTO whatsmiau_instances (id, remote_jid, owner_jid, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (id) DO NOTHING`,
+		instance.ID, instance.RemoteJID, ownerJID(instance.RemoteJID), string(data), now)
+	if err != nil {
+		return err
+	}
+
+	affected, err := inserted.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrorAlreadyExists
+	}
+
+	if err := s.setTags(ctx, tx, instance.ID, instance.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setTags replaces the tags of an instance.
+func (s *SQLInstance) setTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM whatsmiau_instance_tags WHERE instance_id = $1`, id); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO whatsmiau_instance_tags (instance_id, tag) VALUES ($1, $2)`, id, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLInstance) Update(ctx context.Context, id string, toUpdate *models.InstanceUpdate) (*models.Instance, error) {
+	if id == "" {
+		return nil, ErrInstanceIDEmpty
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var raw string
+	err = tx.QueryRowContext(ctx, `SELECT data FROM whatsmiau_instances WHERE id = $1`, id).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var oldInstance models.Instance
+	if err := json.Unmarshal([]byte(raw), &oldInstance); err != nil {
+		return nil, err
+	}
+	toUpdate.Apply(&oldInstance)
+
+	data, err := json.Marshal(oldInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE whatsmiau_instances SET remote_jid = $1, owner_jid = $2, data = $3, updated_at = $4
+		WHERE id = $5`,
+		oldInstance.RemoteJID, ownerJID(oldInstance.RemoteJID), string(data), time.Now().UnixMilli(), id); err != nil {
+		return nil, err
+	}
+
+	if toUpdate.Tags != nil {
+		if err := s.setTags(ctx, tx, id, oldInstance.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	return &oldInstance, tx.Commit()
+}
+
+func (s *SQLInstance) List(ctx context.Context, id string) ([]models.Instance, error) {
+	if len(id) > 0 {
+		instances, _, err := s.query(ctx, `SELECT id, data FROM whatsmiau_instances WHERE id = $1`, id)
+		return instances, err
+	}
+
+	page, err := s.Search(ctx, &models.InstanceFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Instances, nil
+}
+
+func (s *SQLInstance) Search(ctx context.Context, filter *models.InstanceFilter) (*models.InstancePage, error) {
+	return search(ctx, filter, s.page, s.count)
+}
+
+func (s *SQLInstance) page(ctx context.Context, after string, by lookup, n int) ([]models.Instance, string, bool, error) {
+	where, args := s.where(by)
+	args = append(args, after, n)
+	query := fmt.Sprintf(`SELECT id, data FROM whatsmiau_instances WHERE %s id > $%d ORDER BY id LIMIT $%d`, where, len(args)-1, len(args))
+
+	instances, ids, err := s.query(ctx, query, args...)
+	if err != nil || len(ids) == 0 {
+		return instances, "", true, err
+	}
+
+	return instances, ids[len(ids)-1], len(ids) < n, nil
+}
+
+func (s *SQLInstance) count(ctx context.Context, by lookup) (int, error) {
+	where, args := s.where(by)
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM whatsmiau_instances WHERE `+where+` 1 = 1`, args...).Scan(&total)
+	return total, err
+}
+
+// where returns the conditions of a lookup, each followed by AND.
+func (s *SQLInstance) where(by lookup) (string, []any) {
+	var (
+		where string
+		args  []any
+	)
+
+	if by.owner != "" {
+		args = append(args, by.owner)
+		where += fmt.Sprintf("owner_jid = $%d AND ", len(args))
+	}
+	if by.tag != "" {
+		args = append(args, by.tag)
+		where += fmt.Sprintf("id IN (SELECT instance_id FROM whatsmiau_instance_tags WHERE tag = $%d) AND ", len(args))
+	}
+
+	return where, args
+}
+
+// query reads id, data rows, returning the instances and every ID read, as
+// malformed instances are skipped.
+func (s *SQLInstance) query(ctx context.Context, query string, args ...any) ([]models.Instance, []string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		instances = []models.Instance{}
+		ids       []string
+	)
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+
+		var inst models.Instance
+		if err := json.Unmarshal([]byte(raw), &inst); err != nil {
+			zap.L().Warn("skipping malformed instance", zap.String("id", id), zap.Error(err))
+			continue
+		}
+		instances = append(instances, inst)
+	}
+
+	return instances, ids, rows.Err()
+}
+
+func (s *SQLInstance) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrInstanceIDEmpty
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM whatsmiau_instances WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrorNotFound
+	}
+
+	if err := s.setTags(ctx, tx, id, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,71 @@
+package instances
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+func newTestSQL(t *testing.T) *SQLInstance {
+	t.Helper()
+
+	// a file, so the connections of the pool share the database
+	path := filepath.Join(t.TempDir(), "instances.db")
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=10000&_journal_mode=WAL", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close(); _ = os.Remove(path) })
+
+	repo, err := NewSQL(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+func TestSQLInstanceCreateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQL(t)
+
+	const creates = 32
+	errs := make([]error, creates)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range creates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = repo.Create(ctx, &models.Instance{ID: "a", Tags: []string{"t"}})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrorAlreadyExists):
+			t.Errorf("a duplicate create returned %v, want ErrorAlreadyExists", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d creates succeeded, want 1", created)
+	}
+
+	if instances, err := repo.List(ctx, "a"); err != nil || len(instances) != 1 {
+		t.Fatalf("listed %+v (%v), want the instance once", instances, err)
+	}
+}
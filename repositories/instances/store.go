@@ -0,0 +1,50 @@
+package instances
+
+import (
+	"sync"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/services"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// INSTANCE_STORE values
+const (
+	StoreRedis = "redis"
+	StoreSQL   = "sql"
+)
+
+var (
+	repository     interfaces.InstanceRepository
+	repositoryOnce sync.Once
+)
+
+// Get returns the instance repository selected by INSTANCE_STORE.
+func Get() interfaces.InstanceRepository {
+	repositoryOnce.Do(func() {
+		ctx, c := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer c()
+
+		switch env.Env.InstanceStore {
+		case StoreRedis:
+			repo := NewRedis(services.Redis())
+			if err := repo.EnsureIndex(ctx); err != nil {
+				zap.L().Fatal("failed to index redis instances", zap.Error(err))
+			}
+			repository = repo
+		case StoreSQL:
+			repo, err := NewSQL(ctx, services.SQL())
+			if err != nil {
+				zap.L().Fatal("failed to start sql instance store", zap.Error(err))
+			}
+			repository = repo
+		default:
+			zap.L().Fatal("unknown INSTANCE_STORE", zap.String("store", env.Env.InstanceStore))
+		}
+	})
+
+	return repository
+}
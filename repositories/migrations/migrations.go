@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// Migration changes the schema inside the transaction of Apply.
+type Migration func(ctx context.Context, tx *sql.Tx) error
+
+// Exec is a migration running a single statement.
+func Exec(query string) Migration {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// Apply runs the migrations not applied yet, tracking them in a <name>_version
+// table. Released migrations must never be edited or reordered, add a new one
+// instead.
+func Apply(ctx context.Context, db *sql.DB, name string, migrations []Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	table := name + "_version"
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT version FROM `+table).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (version) VALUES (0)`); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](ctx, tx); err != nil {
+			return fmt.Errorf("%s migration %d: %w", name, version+1, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET version = $1`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
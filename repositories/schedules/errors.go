@@ -0,0 +1,8 @@
+package schedules
+
+import "errors"
+
+var (
+	ErrorNotFound      = errors.New("not found")
+	ErrScheduleIDEmpty = errors.New("scheduled message id cannot be empty")
+)
@@ -0,0 +1,242 @@
+package schedules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+// These verify if RedisSchedule follows schedules interface pattern
+var _ interfaces.ScheduleRepository = (*RedisSchedule)(nil)
+
+// queueKey is a sorted set of the pending message IDs scored by when they are
+// due.
+const queueKey = "schedule_queue"
+
+// claimScript atomically takes due members of the queue and pushes their score
+// forward by the lease, so a crashed process only delays a message.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+// extendScript moves a queued member forward to ARGV[2], never backward.
+var extendScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) < tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+end
+return 0
+`)
+
+type RedisSchedule struct {
+	db *redis.Client
+}
+
+func NewRedis(client *redis.Client) *RedisSchedule {
+	return &RedisSchedule{
+		db: client,
+	}
+}
+
+func (s *RedisSchedule) key(id string) string {
+	return fmt.Sprintf("schedule_%s", id)
+}
+
+// instanceKey is a sorted set of the message IDs of an instance scored by SendAt.
+func (s *RedisSchedule) instanceKey(instanceID string) string {
+	return fmt.Sprintf("schedules_instance_%s", instanceID)
+}
+
+func (s *RedisSchedule) save(ctx context.Context, pipe redis.Pipeliner, message *models.ScheduledMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	score := float64(message.SendAt.UnixMilli())
+	pipe.Set(ctx, s.key(message.ID), data, 0)
+	pipe.ZAdd(ctx, s.instanceKey(message.InstanceID), &redis.Z{Score: score, Member: message.ID})
+	if message.Status == models.ScheduledMessagePending {
+		pipe.ZAdd(ctx, queueKey, &redis.Z{Score: score, Member: message.ID})
+	} else {
+		pipe.ZRem(ctx, queueKey, message.ID)
+	}
+	return nil
+}
+
+func (s *RedisSchedule) Create(ctx context.Context, message *models.ScheduledMessage) error {
+	if message.ID == "" {
+		return ErrScheduleIDEmpty
+	}
+
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return s.save(ctx, pipe, message)
+	})
+	return err
+}
+
+func (s *RedisSchedule) Update(ctx context.Context, message *models.ScheduledMessage) error {
+	exists, err := s.db.Exists(ctx, s.key(message.ID)).Result()
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return ErrorNotFound
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return s.save(ctx, pipe, message)
+	})
+	return err
+}
+
+func (s *RedisSchedule) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]models.ScheduledMessage, error) {
+	ids, err := claimScript.Run(ctx, s.db, []string{queueKey},
+		now.UnixMilli(), limit, now.Add(lease).UnixMilli(),
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	messages, missing, err := s.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		if err := s.db.ZRem(ctx, queueKey, toMembers(missing)...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+func (s *RedisSchedule) ExtendLease(ctx context.Context, id string, until time.Time) error {
+	return extendScript.Run(ctx, s.db, []string{queueKey}, id, until.UnixMilli()).Err()
+}
+
+func (s *RedisSchedule) Get(ctx context.Context, id string) (*models.ScheduledMessage, error) {
+	messages, _, err := s.load(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &messages[0], nil
+}
+
+func (s *RedisSchedule) List(ctx context.Context, instanceID string) ([]models.ScheduledMessage, error) {
+	ids, err := s.db.ZRange(ctx, s.instanceKey(instanceID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return []models.ScheduledMessage{}, nil
+	}
+
+	messages, missing, err := s.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		if err := s.db.ZRem(ctx, s.instanceKey(instanceID), toMembers(missing)...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+func (s *RedisSchedule) Delete(ctx context.Context, id string) error {
+	message, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.key(id))
+		pipe.ZRem(ctx, queueKey, id)
+		pipe.ZRem(ctx, s.instanceKey(message.InstanceID), id)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisSchedule) DeleteByInstance(ctx context.Context, instanceID string) error {
+	ids, err := s.db.ZRange(ctx, s.instanceKey(instanceID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, s.key(id))
+			pipe.ZRem(ctx, queueKey, id)
+		}
+		pipe.Del(ctx, s.instanceKey(instanceID))
+		return nil
+	})
+	return err
+}
+
+// load fetches messages by id, also returning the ids whose record is gone.
+func (s *RedisSchedule) load(ctx context.Context, ids []string) ([]models.ScheduledMessage, []string, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+
+	rawVals, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		messages []models.ScheduledMessage
+		missing  []string
+	)
+	for i, raw := range rawVals {
+		strVal, ok := raw.(string)
+		if !ok {
+			missing = append(missing, ids[i])
+			continue
+		}
+
+		var message models.ScheduledMessage
+		if err := json.Unmarshal([]byte(strVal), &message); err != nil {
+			missing = append(missing, ids[i])
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, missing, nil
+}
+
+func toMembers(ids []string) []interface{} {
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	return members
+}
@@ -0,0 +1,221 @@
+package schedules
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/migrations"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// These verify if SQLSchedule follows schedules interface pattern
+var _ interfaces.ScheduleRepository = (*SQLSchedule)(nil)
+
+// next_at is when a pending message is due, it is pushed forward when the
+// message is claimed and is null once the message is no longer pending.
+var schema = []migrations.Migration{
+	migrations.Exec(`CREATE TABLE IF NOT EXISTS whatsmiau_schedules (
+		id          TEXT PRIMARY KEY,
+		instance_id TEXT NOT NULL,
+		send_at     BIGINT NOT NULL,
+		next_at     BIGINT,
+		data        TEXT NOT NULL
+	)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_schedules_instance_id ON whatsmiau_schedules (instance_id, send_at)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_schedules_next_at ON whatsmiau_schedules (next_at)`),
+}
+
+type SQLSchedule struct {
+	db *sql.DB
+}
+
+// NewSQL returns a repository on db, creating or upgrading its tables.
+func NewSQL(ctx context.Context, db *sql.DB) (*SQLSchedule, error) {
+	if err := migrations.Apply(ctx, db, "whatsmiau_schedules", schema); err != nil {
+		return nil, fmt.Errorf("failed to migrate schedules: %w", err)
+	}
+
+	return &SQLSchedule{
+		db: db,
+	}, nil
+}
+
+// nextAt is the next_at column of a message.
+func nextAt(message *models.ScheduledMessage) sql.NullInt64 {
+	return sql.NullInt64{
+		Int64: message.SendAt.UnixMilli(),
+		Valid: message.Status == models.ScheduledMessagePending,
+	}
+}
+
+func (s *SQLSchedule) Create(ctx context.Context, message *models.ScheduledMessage) error {
+	if message.ID == "" {
+		return ErrScheduleIDEmpty
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO whatsmiau_schedules (id, instance_id, send_at, next_at, data)
+		VALUES ($1, $2, $3, $4, $5)`,
+		message.ID, message.InstanceID, message.SendAt.UnixMilli(), nextAt(message), string(data))
+	return err
+}
+
+func (s *SQLSchedule) Update(ctx context.Context, message *models.ScheduledMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE whatsmiau_schedules SET send_at = $1, next_at = $2, data = $3
+		WHERE id = $4`,
+		message.SendAt.UnixMilli(), nextAt(message), string(data), message.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// Claim leases each due message with a conditional update, so concurrent
+// claims never return the same message without row locks, which sqlite lacks.
+func (s *SQLSchedule) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]models.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, next_at, data FROM whatsmiau_schedules
+		WHERE next_at <= $1 ORDER BY next_at LIMIT $2`,
+		now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	type due struct {
+		id, raw string
+		nextAt  int64
+	}
+	var candidates []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.nextAt, &d.raw); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var messages []models.ScheduledMessage
+	for _, d := range candidates {
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE whatsmiau_schedules SET next_at = $1 WHERE id = $2 AND next_at = $3`,
+			now.Add(lease).UnixMilli(), d.id, d.nextAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			continue
+		}
+
+		var message models.ScheduledMessage
+		if err := json.Unmarshal([]byte(d.raw), &message); err != nil {
+			zap.L().Warn("skipping malformed scheduled message", zap.String("id", d.id), zap.Error(err))
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func (s *SQLSchedule) ExtendLease(ctx context.Context, id string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE whatsmiau_schedules SET next_at = $1 WHERE id = $2 AND next_at < $1`,
+		until.UnixMilli(), id)
+	return err
+}
+
+func (s *SQLSchedule) Get(ctx context.Context, id string) (*models.ScheduledMessage, error) {
+	messages, err := s.query(ctx, `SELECT data FROM whatsmiau_schedules WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &messages[0], nil
+}
+
+func (s *SQLSchedule) List(ctx context.Context, instanceID string) ([]models.ScheduledMessage, error) {
+	return s.query(ctx, `SELECT data FROM whatsmiau_schedules WHERE instance_id = $1 ORDER BY send_at, id`, instanceID)
+}
+
+func (s *SQLSchedule) query(ctx context.Context, query string, args ...any) ([]models.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.ScheduledMessage{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+
+		var message models.ScheduledMessage
+		if err := json.Unmarshal([]byte(raw), &message); err != nil {
+			return nil, err
+		}
+		result = append(result, message)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLSchedule) Delete(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM whatsmiau_schedules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLSchedule) DeleteByInstance(ctx context.Context, instanceID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM whatsmiau_schedules WHERE instance_id = $1`, instanceID)
+	return err
+}
@@ -0,0 +1,75 @@
+package schedules
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+func newTestSQL(t *testing.T) *SQLSchedule {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own memory database
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo, err := NewSQL(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+func TestSQLScheduleExtendLease(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQL(t)
+	now := time.Now()
+
+	message := &models.ScheduledMessage{ID: "s1", InstanceID: "a", SendAt: now, Status: models.ScheduledMessagePending}
+	if err := repo.Create(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := repo.Claim(ctx, now, time.Minute, 10); err != nil || len(claimed) != 1 {
+		t.Fatalf("claimed %+v (%v), want s1", claimed, err)
+	}
+
+	// the lease is pushed past its first expiry
+	if err := repo.ExtendLease(ctx, "s1", now.Add(3*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := repo.Claim(ctx, now.Add(2*time.Minute), time.Minute, 10); len(claimed) != 0 {
+		t.Fatalf("an extended lease was claimed: %+v", claimed)
+	}
+
+	// a message rescheduled later is not pulled back
+	message.SendAt = now.Add(time.Hour)
+	if err := repo.Update(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ExtendLease(ctx, "s1", now.Add(4*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := repo.Claim(ctx, now.Add(30*time.Minute), time.Minute, 10); len(claimed) != 0 {
+		t.Fatalf("a rescheduled message was claimed early: %+v", claimed)
+	}
+
+	// a message that was sent stays out of the queue
+	message.Status = models.ScheduledMessageSent
+	if err := repo.Update(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ExtendLease(ctx, "s1", now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := repo.Claim(ctx, now.Add(3*time.Hour), time.Minute, 10); len(claimed) != 0 {
+		t.Fatalf("a sent message was claimed: %+v", claimed)
+	}
+}
@@ -0,0 +1,42 @@
+package schedules
+
+import (
+	"sync"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/services"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+var (
+	repository     interfaces.ScheduleRepository
+	repositoryOnce sync.Once
+)
+
+// Get returns the scheduled message repository, kept in the same store as the
+// instances (INSTANCE_STORE).
+func Get() interfaces.ScheduleRepository {
+	repositoryOnce.Do(func() {
+		switch env.Env.InstanceStore {
+		case instances.StoreRedis:
+			repository = NewRedis(services.Redis())
+		case instances.StoreSQL:
+			ctx, c := context.WithTimeout(context.Background(), time.Minute)
+			defer c()
+
+			repo, err := NewSQL(ctx, services.SQL())
+			if err != nil {
+				zap.L().Fatal("failed to start sql schedule store", zap.Error(err))
+			}
+			repository = repo
+		default:
+			zap.L().Fatal("unknown INSTANCE_STORE", zap.String("store", env.Env.InstanceStore))
+		}
+	})
+
+	return repository
+}
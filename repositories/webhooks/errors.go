@@ -0,0 +1,8 @@
+package webhooks
+
+import "errors"
+
+var (
+	ErrorNotFound      = errors.New("not found")
+	ErrDeliveryIDEmpty = errors.New("delivery id cannot be empty")
+)
@@ -0,0 +1,250 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// These verify if RedisWebhook follows webhooks interface pattern
+var _ interfaces.WebhookRepository = (*RedisWebhook)(nil)
+
+const queueKey = "webhook_queue"
+
+// claimScript atomically takes due members of the queue and pushes their score
+// forward by the lease, so a crashed worker only delays a delivery.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+type RedisWebhook struct {
+	db *redis.Client
+}
+
+func NewRedis(client *redis.Client) *RedisWebhook {
+	return &RedisWebhook{
+		db: client,
+	}
+}
+
+func (s *RedisWebhook) key(id string) string {
+	return fmt.Sprintf("webhook_delivery_%s", id)
+}
+
+func (s *RedisWebhook) instanceKey(instanceID string) string {
+	return fmt.Sprintf("webhook_deliveries_%s", instanceID)
+}
+
+func (s *RedisWebhook) save(ctx context.Context, pipe redis.Pipeliner, delivery *models.WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	pipe.Set(ctx, s.key(delivery.ID), data, redis.KeepTTL)
+	pipe.ZAdd(ctx, s.instanceKey(delivery.InstanceID), &redis.Z{
+		Score:  float64(delivery.CreatedAt.UnixMilli()),
+		Member: delivery.ID,
+	})
+	return nil
+}
+
+func (s *RedisWebhook) Schedule(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if delivery.ID == "" {
+		return ErrDeliveryIDEmpty
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if err := s.save(ctx, pipe, delivery); err != nil {
+			return err
+		}
+		pipe.ZAdd(ctx, queueKey, &redis.Z{
+			Score:  float64(delivery.NextAttemptAt.UnixMilli()),
+			Member: delivery.ID,
+		})
+		return nil
+	})
+	return err
+}
+
+func (s *RedisWebhook) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]models.WebhookDelivery, error) {
+	ids, err := claimScript.Run(ctx, s.db, []string{queueKey},
+		now.UnixMilli(), limit, now.Add(lease).UnixMilli(),
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	deliveries, missing, err := s.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		if err := s.db.ZRem(ctx, queueKey, toMembers(missing)...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (s *RedisWebhook) DeadLetter(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Status = models.WebhookDeliveryFailed
+	delivery.NextAttemptAt = time.Time{}
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if err := s.save(ctx, pipe, delivery); err != nil {
+			return err
+		}
+		pipe.ZRem(ctx, queueKey, delivery.ID)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisWebhook) Done(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return s.Delete(ctx, delivery)
+}
+
+func (s *RedisWebhook) Delete(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.key(delivery.ID))
+		pipe.ZRem(ctx, queueKey, delivery.ID)
+		pipe.ZRem(ctx, s.instanceKey(delivery.InstanceID), delivery.ID)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisWebhook) Get(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	raw, err := s.db.Get(ctx, s.key(id)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrorNotFound
+		}
+		return nil, err
+	}
+
+	var delivery models.WebhookDelivery
+	if err := json.Unmarshal([]byte(raw), &delivery); err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (s *RedisWebhook) List(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	minScore, maxScore := "-inf", "+inf"
+	if !filter.From.IsZero() {
+		minScore = strconv.FormatInt(filter.From.UnixMilli(), 10)
+	}
+	if !filter.To.IsZero() {
+		maxScore = strconv.FormatInt(filter.To.UnixMilli(), 10)
+	}
+
+	ids, err := s.db.ZRangeByScore(ctx, s.instanceKey(filter.InstanceID), &redis.ZRangeBy{
+		Min: minScore,
+		Max: maxScore,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return []models.WebhookDelivery{}, nil
+	}
+
+	deliveries, missing, err := s.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		if err := s.db.ZRem(ctx, s.instanceKey(filter.InstanceID), toMembers(missing)...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]models.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+		result = append(result, delivery)
+		if filter.Limit > 0 && int64(len(result)) >= filter.Limit {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// load fetches deliveries by id, also returning the ids whose record is gone.
+// Records that can't be decoded are deleted and returned as gone, so they
+// don't linger unreachable, the callers drop gone ids from their sets.
+func (s *RedisWebhook) load(ctx context.Context, ids []string) ([]models.WebhookDelivery, []string, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+
+	rawVals, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		deliveries []models.WebhookDelivery
+		missing    []string
+		malformed  []string
+	)
+	for i, raw := range rawVals {
+		strVal, ok := raw.(string)
+		if !ok {
+			missing = append(missing, ids[i])
+			continue
+		}
+
+		var delivery models.WebhookDelivery
+		if err := json.Unmarshal([]byte(strVal), &delivery); err != nil {
+			zap.L().Warn("deleting malformed webhook delivery", zap.String("id", ids[i]), zap.Error(err))
+			malformed = append(malformed, keys[i])
+			missing = append(missing, ids[i])
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(malformed) > 0 {
+		if err := s.db.Del(ctx, malformed...).Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return deliveries, missing, nil
+}
+
+func toMembers(ids []string) []interface{} {
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	return members
+}
@@ -0,0 +1,207 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/migrations"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// These verify if SQLWebhook follows webhooks interface pattern
+var _ interfaces.WebhookRepository = (*SQLWebhook)(nil)
+
+// next_at is when a queued delivery is attempted, it is pushed forward when the
+// delivery is claimed and is null once it is dead-lettered.
+var schema = []migrations.Migration{
+	migrations.Exec(`CREATE TABLE IF NOT EXISTS whatsmiau_webhook_deliveries (
+		id          TEXT PRIMARY KEY,
+		instance_id TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		created_at  BIGINT NOT NULL,
+		next_at     BIGINT,
+		data        TEXT NOT NULL
+	)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_webhook_deliveries_instance_id ON whatsmiau_webhook_deliveries (instance_id, created_at)`),
+	migrations.Exec(`CREATE INDEX IF NOT EXISTS whatsmiau_webhook_deliveries_next_at ON whatsmiau_webhook_deliveries (next_at)`),
+}
+
+type SQLWebhook struct {
+	db *sql.DB
+}
+
+// NewSQL returns a repository on db, creating or upgrading its tables.
+func NewSQL(ctx context.Context, db *sql.DB) (*SQLWebhook, error) {
+	if err := migrations.Apply(ctx, db, "whatsmiau_webhook_deliveries", schema); err != nil {
+		return nil, fmt.Errorf("failed to migrate webhook deliveries: %w", err)
+	}
+
+	return &SQLWebhook{
+		db: db,
+	}, nil
+}
+
+func (s *SQLWebhook) save(ctx context.Context, delivery *models.WebhookDelivery, nextAt sql.NullInt64) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO whatsmiau_webhook_deliveries (id, instance_id, status, created_at, next_at, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status, next_at = excluded.next_at, data = excluded.data`,
+		delivery.ID, delivery.InstanceID, string(delivery.Status), delivery.CreatedAt.UnixMilli(), nextAt, string(data))
+	return err
+}
+
+func (s *SQLWebhook) Schedule(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if delivery.ID == "" {
+		return ErrDeliveryIDEmpty
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	return s.save(ctx, delivery, sql.NullInt64{Int64: delivery.NextAttemptAt.UnixMilli(), Valid: true})
+}
+
+// Claim leases each due delivery with a conditional update, so concurrent
+// claims never return the same delivery without row locks, which sqlite lacks.
+func (s *SQLWebhook) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, next_at, data FROM whatsmiau_webhook_deliveries
+		WHERE next_at <= $1 ORDER BY next_at LIMIT $2`,
+		now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	type due struct {
+		id, raw string
+		nextAt  int64
+	}
+	var candidates []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.nextAt, &d.raw); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, d := range candidates {
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE whatsmiau_webhook_deliveries SET next_at = $1 WHERE id = $2 AND next_at = $3`,
+			now.Add(lease).UnixMilli(), d.id, d.nextAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			continue
+		}
+
+		var delivery models.WebhookDelivery
+		if err := json.Unmarshal([]byte(d.raw), &delivery); err != nil {
+			// it would be claimed again on every lease, and break List
+			zap.L().Warn("deleting malformed webhook delivery", zap.String("id", d.id), zap.Error(err))
+			if _, err := s.db.ExecContext(ctx, `DELETE FROM whatsmiau_webhook_deliveries WHERE id = $1`, d.id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (s *SQLWebhook) DeadLetter(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Status = models.WebhookDeliveryFailed
+	delivery.NextAttemptAt = time.Time{}
+	return s.save(ctx, delivery, sql.NullInt64{})
+}
+
+func (s *SQLWebhook) Done(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return s.Delete(ctx, delivery)
+}
+
+func (s *SQLWebhook) Delete(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM whatsmiau_webhook_deliveries WHERE id = $1`, delivery.ID)
+	return err
+}
+
+func (s *SQLWebhook) Get(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM whatsmiau_webhook_deliveries WHERE id = $1`, id).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery models.WebhookDelivery
+	if err := json.Unmarshal([]byte(raw), &delivery); err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (s *SQLWebhook) List(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	conditions := []string{"instance_id = $1"}
+	args := []any{filter.InstanceID}
+	if filter.Status != "" {
+		args = append(args, string(filter.Status))
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.UnixMilli())
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.UnixMilli())
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", len(args)))
+	}
+
+	query := `SELECT data FROM whatsmiau_webhook_deliveries WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY created_at, id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.WebhookDelivery{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+
+		var delivery models.WebhookDelivery
+		if err := json.Unmarshal([]byte(raw), &delivery); err != nil {
+			return nil, err
+		}
+		result = append(result, delivery)
+	}
+
+	return result, rows.Err()
+}
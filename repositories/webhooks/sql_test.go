@@ -0,0 +1,151 @@
+package webhooks
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"golang.org/x/net/context"
+)
+
+func newTestSQL(t *testing.T) *SQLWebhook {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own memory database
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo, err := NewSQL(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+func TestSQLWebhookQueue(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQL(t)
+	now := time.Now()
+
+	delivery := &models.WebhookDelivery{ID: "d1", InstanceID: "a", CreatedAt: now, NextAttemptAt: now}
+	if err := repo.Schedule(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+	later := &models.WebhookDelivery{ID: "d2", InstanceID: "a", CreatedAt: now, NextAttemptAt: now.Add(time.Hour)}
+	if err := repo.Schedule(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := repo.Claim(ctx, now, time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != "d1" {
+		t.Fatalf("claimed %+v (%v), want d1", claimed, err)
+	}
+	if claimed, _ := repo.Claim(ctx, now.Add(30*time.Second), time.Minute, 10); len(claimed) != 0 {
+		t.Fatalf("a leased delivery was claimed again: %+v", claimed)
+	}
+	if claimed, _ := repo.Claim(ctx, now.Add(2*time.Minute), time.Minute, 10); len(claimed) != 1 || claimed[0].ID != "d1" {
+		t.Fatalf("the lease should expire, claimed %+v", claimed)
+	}
+
+	// a retry is scheduled on the same record
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = now.Add(10 * time.Minute)
+	if err := repo.Schedule(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.Get(ctx, "d1")
+	if err != nil || stored.Attempts != 1 || stored.Status != models.WebhookDeliveryPending {
+		t.Fatalf("retry not stored: %+v (%v)", stored, err)
+	}
+
+	if err := repo.DeadLetter(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := repo.Claim(ctx, now.Add(time.Hour), time.Minute, 10); len(claimed) != 1 || claimed[0].ID != "d2" {
+		t.Fatalf("a dead-lettered delivery should leave the queue, claimed %+v", claimed)
+	}
+
+	if err := repo.Done(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "d2"); !errors.Is(err, ErrorNotFound) {
+		t.Fatalf("a done delivery should be removed, got %v", err)
+	}
+}
+
+func TestSQLWebhookList(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQL(t)
+	start := time.Now()
+
+	for i, delivery := range []*models.WebhookDelivery{
+		{ID: "d1", InstanceID: "a"},
+		{ID: "d2", InstanceID: "a"},
+		{ID: "d3", InstanceID: "a"},
+		{ID: "d4", InstanceID: "b"},
+	} {
+		delivery.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := repo.DeadLetter(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Schedule(ctx, &models.WebhookDelivery{ID: "d5", InstanceID: "a", CreatedAt: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.WebhookDeliveryFilter
+		want   []string
+	}{
+		{"instance", models.WebhookDeliveryFilter{InstanceID: "a"}, []string{"d1", "d5", "d2", "d3"}},
+		{"status", models.WebhookDeliveryFilter{InstanceID: "a", Status: models.WebhookDeliveryFailed}, []string{"d1", "d2", "d3"}},
+		{"range", models.WebhookDeliveryFilter{InstanceID: "a", From: start.Add(time.Minute), To: start.Add(2 * time.Minute)}, []string{"d2", "d3"}},
+		{"limit", models.WebhookDeliveryFilter{InstanceID: "a", Status: models.WebhookDeliveryFailed, Limit: 2}, []string{"d1", "d2"}},
+		{"empty", models.WebhookDeliveryFilter{InstanceID: "c"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveries, err := repo.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []string{}
+			for _, delivery := range deliveries {
+				ids = append(ids, delivery.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("listed %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLWebhookClaimDeletesMalformed(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQL(t)
+	now := time.Now()
+
+	if _, err := repo.db.ExecContext(ctx, `
+		INSERT INTO whatsmiau_webhook_deliveries (id, instance_id, status, created_at, next_at, data)
+		VALUES ('bad', 'a', 'pending', $1, $1, '{')`, now.UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed, err := repo.Claim(ctx, now, time.Minute, 10); err != nil || len(claimed) != 0 {
+		t.Fatalf("claimed %+v (%v), want nothing", claimed, err)
+	}
+	if deliveries, err := repo.List(ctx, models.WebhookDeliveryFilter{InstanceID: "a"}); err != nil || len(deliveries) != 0 {
+		t.Fatalf("listed %+v (%v), the malformed delivery should be deleted", deliveries, err)
+	}
+}
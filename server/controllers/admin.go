@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+)
+
+type Admin struct {
+	repo      interfaces.InstanceRepository
+	whatsmiau *whatsmiau.Whatsmiau
+}
+
+func NewAdmin(repository interfaces.InstanceRepository, whatsmiau *whatsmiau.Whatsmiau) *Admin {
+	return &Admin{
+		repo:      repository,
+		whatsmiau: whatsmiau,
+	}
+}
+
+func (s *Admin) ListUnmatchedDevices(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, dto.ListUnmatchedDevicesResponse{
+		Devices: s.whatsmiau.ListUnmatchedDevices(),
+	})
+}
+
+func (s *Admin) AdoptUnmatchedDevice(ctx echo.Context) error {
+	c := ctx.Request().Context()
+	var request dto.AdoptUnmatchedDeviceRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	result, err := s.repo.List(c, request.InstanceID)
+	if err != nil {
+		zap.L().Error("failed to list instances", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	}
+
+	if len(result) == 0 {
+		return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+	}
+
+	if err := s.whatsmiau.AdoptUnmatchedDevice(c, request.JID, request.InstanceID); err != nil {
+		switch {
+		case errors.Is(err, whatsmiau.ErrDeviceNotFound):
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "unmatched device not found")
+		case errors.Is(err, whatsmiau.ErrInstanceInUse):
+			return utils.HTTPFail(ctx, http.StatusConflict, err, "instance already has a logged in device")
+		}
+		zap.L().Error("failed to adopt unmatched device", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to adopt unmatched device")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.UnmatchedDeviceResponse{
+		Message: "device adopted",
+	})
+}
+
+func (s *Admin) LogoutUnmatchedDevice(ctx echo.Context) error {
+	var request dto.LogoutUnmatchedDeviceRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	if err := s.whatsmiau.LogoutUnmatchedDevice(ctx.Request().Context(), request.JID); err != nil {
+		if errors.Is(err, whatsmiau.ErrDeviceNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "unmatched device not found")
+		}
+		zap.L().Error("failed to logout unmatched device", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to logout unmatched device")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.UnmatchedDeviceResponse{
+		Message: "device logged out",
+	})
+}
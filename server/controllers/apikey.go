@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/apikeys"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+)
+
+type ApiKeys struct {
+	repo      interfaces.ApiKeyRepository
+	instances interfaces.InstanceRepository
+}
+
+func NewApiKeys(repository interfaces.ApiKeyRepository, instances interfaces.InstanceRepository) *ApiKeys {
+	return &ApiKeys{
+		repo:      repository,
+		instances: instances,
+	}
+}
+
+func (s *ApiKeys) List(ctx echo.Context) error {
+	var request dto.ListApiKeysRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	keys, err := s.repo.List(ctx.Request().Context(), request.InstanceID)
+	if err != nil {
+		zap.L().Error("failed to list api keys", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list api keys")
+	}
+
+	response := make([]dto.ApiKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponse(&key))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (s *ApiKeys) Create(ctx echo.Context) error {
+	c := ctx.Request().Context()
+	var request dto.CreateApiKeyRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	if request.InstanceID != "" {
+		if slices.Contains(request.Scopes, models.ScopeAdmin) {
+			return utils.HTTPFail(ctx, http.StatusBadRequest, nil, "keys restricted to an instance can't have the admin scope")
+		}
+
+		result, err := s.instances.List(c, request.InstanceID)
+		if err != nil {
+			zap.L().Error("failed to list instances", zap.Error(err))
+			return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+		}
+
+		if len(result) == 0 {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+		}
+	}
+
+	key, token, err := apikeys.New("", request.Name, request.InstanceID, request.Scopes)
+	if err != nil {
+		zap.L().Error("failed to generate api key", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to generate api key")
+	}
+
+	if err := s.repo.Create(c, key); err != nil {
+		zap.L().Error("failed to create api key", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to create api key")
+	}
+
+	response := apiKeyResponse(key)
+	response.Token = token
+	return ctx.JSON(http.StatusCreated, response)
+}
+
+func (s *ApiKeys) Delete(ctx echo.Context) error {
+	var request dto.DeleteApiKeyRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	if err := s.repo.Delete(ctx.Request().Context(), request.ID); err != nil {
+		if errors.Is(err, apikeys.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "api key not found")
+		}
+		zap.L().Error("failed to delete api key", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to delete api key")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.DeleteApiKeyResponse{
+		Message: "api key deleted",
+	})
+}
+
+func apiKeyResponse(key *models.ApiKey) dto.ApiKeyResponse {
+	return dto.ApiKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		InstanceID: key.InstanceID,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -143,3 +143,77 @@ func (s *Chat) NumberExists(ctx echo.Context) error {
 
 	return ctx.JSON(http.StatusOK, response)
 }
+
+func (s *Chat) UpdateMessage(ctx echo.Context) error {
+	var request dto.UpdateMessageRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	if !request.Key.FromMe {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, nil, "only messages sent by the instance can be edited")
+	}
+
+	remoteJid := request.Key.RemoteJid
+	if len(remoteJid) == 0 {
+		remoteJid = request.Number
+	}
+
+	chat, _, err := messageKeyJIDs(remoteJid, "")
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid message key")
+	}
+
+	var sentAt time.Time
+	if request.MessageTimestamp > 0 {
+		sentAt = time.Unix(request.MessageTimestamp, 0)
+	}
+
+	res, err := s.whatsmiau.EditMessage(ctx.Request().Context(), &whatsmiau.EditMessageRequest{
+		InstanceID: request.InstanceID,
+		RemoteJID:  chat,
+		MessageID:  request.Key.Id,
+		Text:       request.Text,
+		SentAt:     sentAt,
+	})
+	if err != nil {
+		zap.L().Error("Whatsmiau.EditMessage failed", zap.Error(err))
+		return messageActionFail(ctx, err, "failed to edit message")
+	}
+
+	return ctx.JSON(http.StatusOK, messageActionResponse(request.InstanceID, remoteJid, "editedMessage", res.ID, res.CreatedAt))
+}
+
+func (s *Chat) DeleteMessageForEveryone(ctx echo.Context) error {
+	var request dto.DeleteMessageRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	chat, participant, err := messageKeyJIDs(request.RemoteJid, request.Participant)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid message key")
+	}
+
+	res, err := s.whatsmiau.RevokeMessage(ctx.Request().Context(), &whatsmiau.RevokeMessageRequest{
+		InstanceID:  request.InstanceID,
+		RemoteJID:   chat,
+		MessageID:   request.Id,
+		FromMe:      request.FromMe,
+		Participant: participant,
+	})
+	if err != nil {
+		zap.L().Error("Whatsmiau.RevokeMessage failed", zap.Error(err))
+		return messageActionFail(ctx, err, "failed to delete message")
+	}
+
+	return ctx.JSON(http.StatusOK, messageActionResponse(request.InstanceID, request.RemoteJid, "protocolMessage", res.ID, res.CreatedAt))
+}
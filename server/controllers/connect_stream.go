@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/skip2/go-qrcode"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+)
+
+const connectStreamHeartbeat = 15 * time.Second
+
+// ConnectStream follows the login of an instance as server-sent events: every
+// new QR code or pairing code, and a final open or closed event.
+func (s *Instance) ConnectStream(ctx echo.Context) error {
+	c := ctx.Request().Context()
+	var request dto.ConnectInstanceRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	result, err := s.repo.List(c, request.ID)
+	if err != nil {
+		zap.L().Error("failed to list instances", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	}
+
+	if len(result) == 0 {
+		return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+	}
+
+	events, current, stop := s.whatsmiau.WatchConnection(request.ID)
+	defer stop()
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	if current != nil {
+		if err := writeConnectEvent(res, current); err != nil || current.Final() {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(connectStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event := <-events:
+			if err := writeConnectEvent(res, &event); err != nil || event.Final() {
+				return nil
+			}
+		}
+	}
+}
+
+func writeConnectEvent(res *echo.Response, event *whatsmiau.ConnectionEvent) error {
+	data := dto.ConnectStreamEvent{
+		Code:        event.Code,
+		PairingCode: event.PairingCode,
+		RemoteJID:   event.RemoteJID,
+		Reason:      event.Reason,
+		DateTime:    event.DateTime,
+	}
+
+	switch event.Type {
+	case whatsmiau.ConnectionEventQrCode:
+		png, err := qrcode.Encode(event.Code, qrcode.Medium, 256)
+		if err != nil {
+			zap.L().Error("failed to encode qrcode", zap.Error(err))
+		} else {
+			data.Base64 = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		}
+	case whatsmiau.ConnectionEventOpen:
+		data.State = whatsmiau.Connected
+	case whatsmiau.ConnectionEventClosed:
+		data.State = whatsmiau.Closed
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, body); err != nil {
+		return err
+	}
+
+	res.Flush()
+	return nil
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	eventStreamSubscribeTimeout = 10 * time.Second
+	eventStreamWriteTimeout     = 10 * time.Second
+)
+
+type Events struct {
+	repo      interfaces.InstanceRepository
+	whatsmiau *whatsmiau.Whatsmiau
+}
+
+func NewEvents(repository interfaces.InstanceRepository, whatsmiau *whatsmiau.Whatsmiau) *Events {
+	return &Events{
+		repo:      repository,
+		whatsmiau: whatsmiau,
+	}
+}
+
+// Stream upgrades to a websocket that receives the same events sent to the
+// instance webhook, or those of every instance when no id is given.
+func (s *Events) Stream(ctx echo.Context) error {
+	var request dto.EventStreamRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	// a key bound to an instance only streams that one, the routes of another
+	// instance are refused by middleware.Require
+	if scoped := middleware.KeyInstance(ctx); scoped != "" {
+		request.ID = scoped
+	}
+
+	if len(request.ID) > 0 {
+		result, err := s.repo.List(ctx.Request().Context(), request.ID)
+		if err != nil {
+			zap.L().Error("failed to list instances", zap.Error(err))
+			return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+		}
+
+		if len(result) == 0 {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+		}
+	}
+
+	server := websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			s.stream(conn, request.ID)
+		},
+	}
+	server.ServeHTTP(ctx.Response(), ctx.Request())
+	return nil
+}
+
+func (s *Events) stream(conn *websocket.Conn, instanceID string) {
+	defer conn.Close()
+
+	var subscribe dto.EventStreamSubscribe
+	_ = conn.SetReadDeadline(time.Now().Add(eventStreamSubscribeTimeout))
+	if err := websocket.JSON.Receive(conn, &subscribe); err != nil {
+		s.send(conn, &dto.EventStreamFrame{
+			Type:    dto.EventStreamFrameError,
+			Message: "expected a subscribe message",
+		})
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	sub, backlog, complete := s.whatsmiau.SubscribeEvents(instanceID, subscribe.Events, subscribe.Cursor)
+	defer s.whatsmiau.UnsubscribeEvents(sub)
+
+	if !s.send(conn, &dto.EventStreamFrame{
+		Type:     dto.EventStreamFrameSubscribed,
+		Cursor:   subscribe.Cursor,
+		Complete: &complete,
+	}) {
+		return
+	}
+
+	for i := range backlog {
+		if !s.sendEvent(conn, &backlog[i]) {
+			return
+		}
+	}
+
+	// the client is not expected to send anything else, reading only detects
+	// when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard []byte
+		for websocket.Message.Receive(conn, &discard) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					s.send(conn, &dto.EventStreamFrame{
+						Type:    dto.EventStreamFrameError,
+						Message: "subscriber too slow, reconnect with the last cursor received",
+					})
+				}
+				return
+			}
+
+			if !s.sendEvent(conn, &event) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Events) sendEvent(conn *websocket.Conn, event *whatsmiau.StreamEvent) bool {
+	return s.send(conn, &dto.EventStreamFrame{
+		Type:     dto.EventStreamFrameEvent,
+		Cursor:   event.Cursor,
+		Instance: event.Instance,
+		Event:    event.Event.Name(),
+		Data:     event.Payload,
+	})
+}
+
+func (s *Events) send(conn *websocket.Conn, frame *dto.EventStreamFrame) bool {
+	_ = conn.SetWriteDeadline(time.Now().Add(eventStreamWriteTimeout))
+	if err := websocket.JSON.Send(conn, frame); err != nil {
+		zap.L().Debug("failed to write event stream frame", zap.Error(err))
+		return false
+	}
+
+	return true
+}
@@ -1,10 +1,25 @@
 package controllers
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func numberToJid(number string) (*types.JID, error) {
@@ -24,3 +39,166 @@ func numberToJid(number string) (*types.JID, error) {
 
 	return &jid, nil
 }
+
+// publicInstance is instance as answered, without the webhook secret, which
+// is only accepted on writes.
+func publicInstance(instance *models.Instance) *models.Instance {
+	public := *instance
+	public.Webhook.Secret = ""
+	return &public
+}
+
+// quoteFromRequest converts the Evolution quoted field of a send to to, nil
+// when the send is not a reply.
+func quoteFromRequest(quoted *dto.MessageRequestQuoted, to *types.JID) (*whatsmiau.Quote, error) {
+	if quoted == nil || len(quoted.Key.Id) == 0 {
+		return nil, nil
+	}
+
+	quote := &whatsmiau.Quote{
+		MessageID: quoted.Key.Id,
+		FromMe:    quoted.Key.FromMe,
+	}
+
+	chat := *to
+	if len(quoted.Key.RemoteJid) > 0 {
+		jid, err := numberToJid(quoted.Key.RemoteJid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted remoteJid: %w", err)
+		}
+		quote.RemoteJID = jid
+		chat = *jid
+	}
+
+	if len(quoted.Key.Participant) > 0 {
+		jid, err := numberToJid(quoted.Key.Participant)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted participant: %w", err)
+		}
+		quote.Participant = jid
+	} else if !quote.FromMe && chat.Server == types.GroupServer {
+		return nil, whatsmiau.ErrParticipantRequired
+	}
+
+	if len(quoted.Message) > 0 && string(quoted.Message) != "null" {
+		var message waE2E.Message
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(quoted.Message, &message); err != nil {
+			return nil, fmt.Errorf("invalid quoted message: %w", err)
+		}
+		quote.Message = &message
+	}
+
+	return quote, nil
+}
+
+// messageKeyJIDs parses the chat and, when given, the participant of the key
+// of an existing message.
+func messageKeyJIDs(remoteJid, participant string) (*types.JID, *types.JID, error) {
+	chat, err := numberToJid(remoteJid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid remoteJid: %w", err)
+	}
+
+	if len(participant) == 0 {
+		return chat, nil, nil
+	}
+
+	sender, err := numberToJid(participant)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid participant: %w", err)
+	}
+
+	return chat, sender, nil
+}
+
+// messageActionFail answers a failed reaction, edit or revoke.
+func messageActionFail(ctx echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, whatsmiau.ErrEditWindowExpired):
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "the edit window of the message has expired")
+	case errors.Is(err, whatsmiau.ErrParticipantRequired):
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "participant is required in groups")
+	}
+
+	return sendFail(ctx, err, message)
+}
+
+func messageActionResponse(instanceID, remoteJid, messageType, id string, createdAt time.Time) dto.MessageActionResponse {
+	return dto.MessageActionResponse{
+		Key: dto.MessageResponseKey{
+			RemoteJid: remoteJid,
+			FromMe:    true,
+			Id:        id,
+		},
+		Status:           "sent",
+		MessageType:      messageType,
+		MessageTimestamp: int(createdAt.Unix()),
+		InstanceId:       instanceID,
+	}
+}
+
+// mentionsFromRequest parses the mentioned numbers or JIDs of a send.
+func mentionsFromRequest(mentioned []string) ([]types.JID, error) {
+	jids := make([]types.JID, 0, len(mentioned))
+	for _, number := range mentioned {
+		jid, err := numberToJid(number)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mention %q: %w", number, err)
+		}
+		jids = append(jids, *jid)
+	}
+
+	return jids, nil
+}
+
+// stickerFromRequest returns the URL of a sticker, or its data when it was
+// uploaded or sent as base64.
+func stickerFromRequest(ctx echo.Context, sticker string) (string, []byte, error) {
+	if file, err := ctx.FormFile("sticker"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(io.LimitReader(f, env.Env.StickerMaxBytes+1))
+		return "", data, err
+	}
+
+	switch {
+	case len(sticker) == 0:
+		return "", nil, errors.New("sticker is required")
+	case strings.HasPrefix(sticker, "http://"), strings.HasPrefix(sticker, "https://"):
+		return sticker, nil, nil
+	}
+
+	if _, encoded, ok := strings.Cut(sticker, ";base64,"); ok && strings.HasPrefix(sticker, "data:") {
+		sticker = encoded
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sticker)
+	if err != nil {
+		return "", nil, fmt.Errorf("sticker is neither a URL nor base64: %w", err)
+	}
+
+	return "", data, nil
+}
+
+// sendFail answers a failed send, with 429 and Retry-After when it hit a send
+// limit, or 4xx when the sticker is invalid.
+func sendFail(ctx echo.Context, err error, message string) error {
+	var limited *whatsmiau.RateLimitError
+	if errors.As(err, &limited) {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+		return utils.HTTPFail(ctx, http.StatusTooManyRequests, err, "send limit reached")
+	}
+
+	switch {
+	case errors.Is(err, whatsmiau.ErrStickerFormat):
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid sticker")
+	case errors.Is(err, whatsmiau.ErrStickerTooLarge):
+		return utils.HTTPFail(ctx, http.StatusRequestEntityTooLarge, err, "sticker too large")
+	}
+
+	return utils.HTTPFail(ctx, http.StatusInternalServerError, err, message)
+}
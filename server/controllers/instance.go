@@ -4,9 +4,11 @@ import (
 	"encoding/base64"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
 	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/apikeys"
 	"github.com/verbeux-ai/whatsmiau/repositories/instances"
 	"go.mau.fi/whatsmeow/types"
 
@@ -15,18 +17,23 @@ import (
 	"github.com/skip2/go-qrcode"
 	"github.com/verbeux-ai/whatsmiau/interfaces"
 	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
 	"github.com/verbeux-ai/whatsmiau/utils"
 	"go.uber.org/zap"
 )
 
 type Instance struct {
 	repo      interfaces.InstanceRepository
+	keys      interfaces.ApiKeyRepository
+	schedules interfaces.ScheduleRepository
 	whatsmiau *whatsmiau.Whatsmiau
 }
 
-func NewInstances(repository interfaces.InstanceRepository, whatsmiau *whatsmiau.Whatsmiau) *Instance {
+func NewInstances(repository interfaces.InstanceRepository, keys interfaces.ApiKeyRepository, schedules interfaces.ScheduleRepository, whatsmiau *whatsmiau.Whatsmiau) *Instance {
 	return &Instance{
 		repo:      repository,
+		keys:      keys,
+		schedules: schedules,
 		whatsmiau: whatsmiau,
 	}
 }
@@ -57,15 +64,34 @@ func (s *Instance) Create(ctx echo.Context) error {
 		}
 	}
 	request.RemoteJID = ""
+	request.Tags = models.NormalizeTags(request.Tags)
 
 	c := ctx.Request().Context()
+	key, token, err := apikeys.New(request.Token, "instance", request.Instance.ID, models.InstanceScopes)
+	if err != nil {
+		zap.L().Error("failed to generate instance token", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to generate instance token")
+	}
+
 	if err := s.repo.Create(c, request.Instance); err != nil {
 		zap.L().Error("failed to create instance", zap.Error(err))
 		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to create instance")
 	}
 
+	if err := s.keys.Create(c, key); err != nil {
+		if deleteErr := s.repo.Delete(c, request.Instance.ID); deleteErr != nil {
+			zap.L().Error("failed to roll instance back", zap.Error(deleteErr))
+		}
+		if errors.Is(err, apikeys.ErrorAlreadyExists) {
+			return utils.HTTPFail(ctx, http.StatusConflict, err, "token already in use")
+		}
+		zap.L().Error("failed to create instance token", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to create instance token")
+	}
+
 	return ctx.JSON(http.StatusCreated, dto.CreateInstanceResponse{
-		Instance: request.Instance,
+		Instance: publicInstance(request.Instance),
+		Hash:     token,
 	})
 }
 
@@ -80,22 +106,18 @@ func (s *Instance) Update(ctx echo.Context) error {
 	}
 
 	c := ctx.Request().Context()
-	instance, err := s.repo.Update(c, request.ID, &models.Instance{
-		ID: request.ID,
-		Webhook: models.InstanceWebhook{
-			Base64: &[]bool{request.Webhook.Base64}[0],
-		},
-	})
+	instance, err := s.repo.Update(c, request.ID, &request.InstanceUpdate)
 	if err != nil {
 		if errors.Is(err, instances.ErrorNotFound) {
 			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
 		}
-		zap.L().Error("failed to create instance", zap.Error(err))
+		zap.L().Error("failed to update instance", zap.Error(err))
 		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to update instance")
 	}
+	s.whatsmiau.ReloadInstance(request.ID)
 
 	return ctx.JSON(http.StatusCreated, dto.UpdateInstanceResponse{
-		Instance: instance,
+		Instance: publicInstance(instance),
 	})
 }
 
@@ -105,17 +127,63 @@ func (s *Instance) List(ctx echo.Context) error {
 	if err := ctx.Bind(&request); err != nil {
 		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
 	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
 	if request.InstanceName == "" {
 		request.InstanceName = request.ID
 	}
 
-	result, err := s.repo.List(c, request.InstanceName)
-	if err != nil {
-		zap.L().Error("failed to list instances", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	// a key bound to an instance only lists that one
+	if scoped := middleware.KeyInstance(ctx); scoped != "" {
+		if request.InstanceName != "" && request.InstanceName != scoped {
+			return ctx.JSON(http.StatusOK, []dto.ListInstancesResponse{})
+		}
+		request.InstanceName = scoped
+	}
+
+	var result []models.Instance
+	if request.InstanceName != "" {
+		instances, err := s.repo.List(c, request.InstanceName)
+		if err != nil {
+			zap.L().Error("failed to list instances", zap.Error(err))
+			return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+		}
+		result = instances
+	} else {
+		filter := &models.InstanceFilter{
+			After:    request.Cursor,
+			Limit:    request.Limit,
+			OwnerJID: request.OwnerJID,
+			Tag:      request.Tag,
+			Count:    request.Count,
+		}
+		if request.Status != "" {
+			filter.Match = func(instance models.Instance) bool {
+				status, err := s.whatsmiau.Status(instance.ID)
+				return err == nil && string(status) == request.Status
+			}
+		}
+
+		page, err := s.repo.Search(c, filter)
+		if err != nil {
+			zap.L().Error("failed to list instances", zap.Error(err))
+			return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+		}
+		result = page.Instances
+
+		// the body stays a plain list for Evolution API compatibility
+		if page.Next != "" {
+			ctx.Response().Header().Set("X-Next-Cursor", page.Next)
+		}
+		if request.Count {
+			ctx.Response().Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+		}
 	}
 
-	var response []dto.ListInstancesResponse
+	response := make([]dto.ListInstancesResponse, 0, len(result))
 	for _, instance := range result {
 		jid, err := types.ParseJID(instance.RemoteJID)
 		if err != nil {
@@ -130,7 +198,7 @@ func (s *Instance) List(ctx echo.Context) error {
 		}
 
 		response = append(response, dto.ListInstancesResponse{
-			Instance: &instance,
+			Instance: publicInstance(&instance),
 			OwnerJID: jid.ToNonAD().String(),
 			Status:   string(status),
 		})
@@ -213,6 +281,7 @@ func (s *Instance) Status(ctx echo.Context) error {
 		ID:        request.ID,
 		Status:    string(status),
 		RemoteJID: remoteJID,
+		Reason:    s.whatsmiau.StatusReason(request.ID),
 		Instance: &dto.StatusInstanceResponseEvolutionCompatibility{
 			InstanceName: request.ID,
 			State:        string(status),
@@ -220,6 +289,46 @@ func (s *Instance) Status(ctx echo.Context) error {
 	})
 }
 
+func (s *Instance) Restart(ctx echo.Context) error {
+	c := ctx.Request().Context()
+	var request dto.RestartInstanceRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	result, err := s.repo.List(c, request.ID)
+	if err != nil {
+		zap.L().Error("failed to list instances", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	}
+
+	if len(result) == 0 {
+		return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+	}
+
+	if err := s.whatsmiau.Restart(request.ID); err != nil {
+		if errors.Is(err, whatsmiau.ErrNoSession) {
+			return utils.HTTPFail(ctx, http.StatusConflict, err, "instance is not logged in")
+		}
+		zap.L().Error("failed to restart instance", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to restart instance, retrying in background")
+	}
+
+	status, err := s.whatsmiau.Status(request.ID)
+	if err != nil {
+		zap.L().Error("failed to get status instance", zap.Error(err))
+	}
+
+	return ctx.JSON(http.StatusOK, dto.RestartInstanceResponse{
+		Message: "instance restarted",
+		State:   string(status),
+	})
+}
+
 func (s *Instance) Logout(ctx echo.Context) error {
 	c := ctx.Request().Context()
 	var request dto.DeleteInstanceRequest
@@ -280,6 +389,14 @@ func (s *Instance) Delete(ctx echo.Context) error {
 		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to delete instance")
 	}
 
+	if err := s.keys.DeleteByInstance(c, request.ID); err != nil {
+		zap.L().Error("failed to delete instance api keys", zap.Error(err), zap.String("instance", request.ID))
+	}
+	if err := s.schedules.DeleteByInstance(c, request.ID); err != nil {
+		zap.L().Error("failed to delete instance scheduled messages", zap.Error(err), zap.String("instance", request.ID))
+	}
+	s.whatsmiau.ReloadInstance(request.ID)
+
 	return ctx.JSON(http.StatusOK, dto.DeleteInstanceResponse{
 		Message: "instance deleted",
 	})
@@ -296,10 +413,9 @@ func (s *Instance) UpdateReadSettings(ctx echo.Context) error {
 	}
 
 	c := ctx.Request().Context()
-	instance, err := s.repo.Update(c, request.ID, &models.Instance{
-		ID:               request.ID,
-		AutoReadMessages: request.AutoReadMessages,
-		ReadDelay:        request.ReadDelay,
+	instance, err := s.repo.Update(c, request.ID, &models.InstanceUpdate{
+		AutoReadMessages: &request.AutoReadMessages,
+		ReadDelay:        &request.ReadDelay,
 	})
 	if err != nil {
 		if errors.Is(err, instances.ErrorNotFound) {
@@ -308,9 +424,10 @@ func (s *Instance) UpdateReadSettings(ctx echo.Context) error {
 		zap.L().Error("failed to update read settings", zap.Error(err))
 		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to update read settings")
 	}
+	s.whatsmiau.ReloadInstance(request.ID)
 
 	return ctx.JSON(http.StatusOK, dto.UpdateReadSettingsResponse{
-		Instance: instance,
+		Instance: publicInstance(instance),
 	})
 }
 
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/verbeux-ai/whatsmiau/utils"
 	"go.mau.fi/whatsmeow/types"
 	"go.uber.org/zap"
+	"golang.org/x/net/context"
 )
 
 type Message struct {
@@ -42,40 +44,65 @@ func (s *Message) SendText(ctx echo.Context) error {
 		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
 	}
 
+	quote, err := quoteFromRequest(request.Quoted, jid)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid quoted message")
+	}
+
+	mentioned, err := mentionsFromRequest(request.Mentioned)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid mentioned number")
+	}
+
 	sendText := &whatsmiau.SendText{
-		Text:       request.Text,
-		InstanceID: request.InstanceID,
-		RemoteJID:  jid,
-	}
-
-	if request.Quoted != nil && len(request.Quoted.Key.Id) > 0 && len(request.Quoted.Message.Conversation) > 0 {
-		sendText.QuoteMessage = request.Quoted.Message.Conversation
-		sendText.QuoteMessageID = request.Quoted.Key.Id
-	}
-
-	c := ctx.Request().Context()
-	if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
-		InstanceID: request.InstanceID,
-		RemoteJID:  jid,
-		Presence:   types.ChatPresenceComposing,
-	}); err != nil {
-		zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
-	} else {
-		// Delay padrão de 6 segundos para texto
-		delay := request.Delay
-		if delay == 0 {
-			delay = 6000 // 6 segundos em millisegundos
+		Text:            request.Text,
+		InstanceID:      request.InstanceID,
+		RemoteJID:       jid,
+		Quote:           quote,
+		Mentioned:       mentioned,
+		MentionEveryone: request.MentionsEveryOne,
+		LinkPreview:     request.LinkPreview,
+	}
+
+	var res *whatsmiau.SendTextResponse
+	send := func(c context.Context) (string, error) {
+		c, err := s.whatsmiau.AllowSend(c, request.InstanceID, *jid)
+		if err != nil {
+			return "", err
+		}
+
+		if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
+			InstanceID: request.InstanceID,
+			RemoteJID:  jid,
+			Presence:   types.ChatPresenceComposing,
+		}); err != nil {
+			zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
+		} else {
+			// Delay padrão de 6 segundos para texto
+			delay := request.Delay
+			if delay == 0 {
+				delay = 6000 // 6 segundos em millisegundos
+			}
+			time.Sleep(time.Millisecond * time.Duration(delay))
+		}
+
+		res, err = s.whatsmiau.SendText(c, sendText)
+		if err != nil {
+			return "", err
 		}
-		time.Sleep(time.Millisecond * time.Duration(delay))
+		return res.ID, nil
 	}
 
-	res, err := s.whatsmiau.SendText(c, sendText)
-	if err != nil {
+	if request.Async {
+		return s.enqueue(ctx, request.InstanceID, jid, "conversation", send)
+	}
+
+	if _, err := send(ctx.Request().Context()); err != nil {
 		zap.L().Error("Whatsmiau.SendText failed", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send text")
+		return sendFail(ctx, err, "failed to send text")
 	}
 
-	return ctx.JSON(http.StatusOK, dto.SendTextResponse{
+	response := dto.SendTextResponse{
 		Key: dto.MessageResponseKey{
 			RemoteJid: request.Number,
 			FromMe:    true,
@@ -88,7 +115,18 @@ func (s *Message) SendText(ctx echo.Context) error {
 		MessageType:      "conversation",
 		MessageTimestamp: int(res.CreatedAt.Unix() / 1000),
 		InstanceId:       request.InstanceID,
-	})
+	}
+	if quote != nil {
+		response.ContextInfo = dto.SendTextResponseContextInfo{
+			Participant: request.Quoted.Key.Participant,
+			StanzaId:    quote.MessageID,
+			QuotedMessage: dto.ContextInfoQuotedMessage{
+				Conversation: quote.Message.GetConversation(),
+			},
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, response)
 }
 
 func (s *Message) SendAudio(ctx echo.Context) error {
@@ -107,39 +145,63 @@ func (s *Message) SendAudio(ctx echo.Context) error {
 		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
 	}
 
+	quote, err := quoteFromRequest(request.Quoted, jid)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid quoted message")
+	}
+
+	mentioned, err := mentionsFromRequest(request.Mentioned)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid mentioned number")
+	}
+
 	sendText := &whatsmiau.SendAudio{
-		AudioURL:   request.Audio,
-		InstanceID: request.InstanceID,
-		RemoteJID:  jid,
-		ViewOnce:   request.ViewOnce,
-	}
-
-	if request.Quoted != nil && len(request.Quoted.Key.Id) > 0 && len(request.Quoted.Message.Conversation) > 0 {
-		sendText.QuoteMessage = request.Quoted.Message.Conversation
-		sendText.QuoteMessageID = request.Quoted.Key.Id
-	}
-
-	c := ctx.Request().Context()
-	if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
-		InstanceID: request.InstanceID,
-		RemoteJID:  jid,
-		Presence:   types.ChatPresenceComposing,
-		Media:      types.ChatPresenceMediaAudio,
-	}); err != nil {
-		zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
-	} else {
-		// Delay padrão de 12 segundos para áudio
-		delay := request.Delay
-		if delay == 0 {
-			delay = 12000 // 12 segundos em millisegundos
+		AudioURL:        request.Audio,
+		InstanceID:      request.InstanceID,
+		RemoteJID:       jid,
+		ViewOnce:        request.ViewOnce,
+		Quote:           quote,
+		Mentioned:       mentioned,
+		MentionEveryone: request.MentionsEveryOne,
+	}
+
+	var res *whatsmiau.SendAudioResponse
+	send := func(c context.Context) (string, error) {
+		c, err := s.whatsmiau.AllowSend(c, request.InstanceID, *jid)
+		if err != nil {
+			return "", err
 		}
-		time.Sleep(time.Millisecond * time.Duration(delay))
+
+		if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
+			InstanceID: request.InstanceID,
+			RemoteJID:  jid,
+			Presence:   types.ChatPresenceComposing,
+			Media:      types.ChatPresenceMediaAudio,
+		}); err != nil {
+			zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
+		} else {
+			// Delay padrão de 12 segundos para áudio
+			delay := request.Delay
+			if delay == 0 {
+				delay = 12000 // 12 segundos em millisegundos
+			}
+			time.Sleep(time.Millisecond * time.Duration(delay))
+		}
+
+		res, err = s.whatsmiau.SendAudio(c, sendText)
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
 	}
 
-	res, err := s.whatsmiau.SendAudio(c, sendText)
-	if err != nil {
+	if request.Async {
+		return s.enqueue(ctx, request.InstanceID, jid, "audioMessage", send)
+	}
+
+	if _, err := send(ctx.Request().Context()); err != nil {
 		zap.L().Error("Whatsmiau.SendAudio failed", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send audio")
+		return sendFail(ctx, err, "failed to send audio")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendAudioResponse{
@@ -197,22 +259,51 @@ func (s *Message) sendDocument(ctx echo.Context, request dto.SendDocumentRequest
 		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
 	}
 
+	quote, err := quoteFromRequest(request.Quoted, jid)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid quoted message")
+	}
+
+	mentioned, err := mentionsFromRequest(request.Mentioned)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid mentioned number")
+	}
+
 	sendData := &whatsmiau.SendDocumentRequest{
-		InstanceID: request.InstanceID,
-		MediaURL:   request.Media,
-		Caption:    request.Caption,
-		FileName:   request.FileName,
-		RemoteJID:  jid,
-		Mimetype:   request.Mimetype,
+		InstanceID:      request.InstanceID,
+		MediaURL:        request.Media,
+		Caption:         request.Caption,
+		FileName:        request.FileName,
+		RemoteJID:       jid,
+		Mimetype:        request.Mimetype,
+		Quote:           quote,
+		Mentioned:       mentioned,
+		MentionEveryone: request.MentionsEveryOne,
+	}
+
+	var res *whatsmiau.SendDocumentResponse
+	send := func(c context.Context) (string, error) {
+		c, err := s.whatsmiau.AllowSend(c, request.InstanceID, *jid)
+		if err != nil {
+			return "", err
+		}
+
+		time.Sleep(time.Millisecond * time.Duration(request.Delay)) // TODO: create a more robust solution
+
+		res, err = s.whatsmiau.SendDocument(c, sendData)
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
 	}
 
-	c := ctx.Request().Context()
-	time.Sleep(time.Millisecond * time.Duration(request.Delay)) // TODO: create a more robust solution
+	if request.Async {
+		return s.enqueue(ctx, request.InstanceID, jid, "documentMessage", send)
+	}
 
-	res, err := s.whatsmiau.SendDocument(c, sendData)
-	if err != nil {
+	if _, err := send(ctx.Request().Context()); err != nil {
 		zap.L().Error("Whatsmiau.SendDocument failed", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send document")
+		return sendFail(ctx, err, "failed to send document")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendDocumentResponse{
@@ -248,36 +339,65 @@ func (s *Message) sendImage(ctx echo.Context, request dto.SendDocumentRequest) e
 		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
 	}
 
+	quote, err := quoteFromRequest(request.Quoted, jid)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid quoted message")
+	}
+
+	mentioned, err := mentionsFromRequest(request.Mentioned)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid mentioned number")
+	}
+
 	sendData := &whatsmiau.SendImageRequest{
-		InstanceID: request.InstanceID,
-		MediaURL:   request.Media,
-		Caption:    request.Caption,
-		RemoteJID:  jid,
-		Mimetype:   request.Mimetype,
-		ViewOnce:   request.ViewOnce,
-	}
-
-	c := ctx.Request().Context()
-	if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
-		InstanceID: request.InstanceID,
-		RemoteJID:  jid,
-		Presence:   types.ChatPresenceComposing,
-		Media:      types.ChatPresenceMediaText,
-	}); err != nil {
-		zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
-	} else {
-		// Delay padrão de 2 segundos para imagem
-		delay := request.Delay
-		if delay == 0 {
-			delay = 2000 // 2 segundos em millisegundos
+		InstanceID:      request.InstanceID,
+		MediaURL:        request.Media,
+		Caption:         request.Caption,
+		RemoteJID:       jid,
+		Mimetype:        request.Mimetype,
+		ViewOnce:        request.ViewOnce,
+		Quote:           quote,
+		Mentioned:       mentioned,
+		MentionEveryone: request.MentionsEveryOne,
+	}
+
+	var res *whatsmiau.SendImageResponse
+	send := func(c context.Context) (string, error) {
+		c, err := s.whatsmiau.AllowSend(c, request.InstanceID, *jid)
+		if err != nil {
+			return "", err
+		}
+
+		if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
+			InstanceID: request.InstanceID,
+			RemoteJID:  jid,
+			Presence:   types.ChatPresenceComposing,
+			Media:      types.ChatPresenceMediaText,
+		}); err != nil {
+			zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
+		} else {
+			// Delay padrão de 2 segundos para imagem
+			delay := request.Delay
+			if delay == 0 {
+				delay = 2000 // 2 segundos em millisegundos
+			}
+			time.Sleep(time.Millisecond * time.Duration(delay))
+		}
+
+		res, err = s.whatsmiau.SendImage(c, sendData)
+		if err != nil {
+			return "", err
 		}
-		time.Sleep(time.Millisecond * time.Duration(delay))
+		return res.ID, nil
 	}
 
-	res, err := s.whatsmiau.SendImage(c, sendData)
-	if err != nil {
+	if request.Async {
+		return s.enqueue(ctx, request.InstanceID, jid, "imageMessage", send)
+	}
+
+	if _, err := send(ctx.Request().Context()); err != nil {
 		zap.L().Error("Whatsmiau.SendDocument failed", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send document")
+		return sendFail(ctx, err, "failed to send document")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendDocumentResponse{
@@ -313,36 +433,65 @@ func (s *Message) sendVideo(ctx echo.Context, request dto.SendDocumentRequest) e
 		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
 	}
 
+	quote, err := quoteFromRequest(request.Quoted, jid)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid quoted message")
+	}
+
+	mentioned, err := mentionsFromRequest(request.Mentioned)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid mentioned number")
+	}
+
 	sendData := &whatsmiau.SendVideoRequest{
-		InstanceID: request.InstanceID,
-		MediaURL:   request.Media,
-		Caption:    request.Caption,
-		RemoteJID:  jid,
-		Mimetype:   request.Mimetype,
-		ViewOnce:   request.ViewOnce,
-	}
-
-	c := ctx.Request().Context()
-	if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
-		InstanceID: request.InstanceID,
-		RemoteJID:  jid,
-		Presence:   types.ChatPresenceComposing,
-		Media:      types.ChatPresenceMediaText,
-	}); err != nil {
-		zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
-	} else {
-		// Delay padrão de 2 segundos para vídeo
-		delay := request.Delay
-		if delay == 0 {
-			delay = 2000 // 2 segundos em millisegundos
+		InstanceID:      request.InstanceID,
+		MediaURL:        request.Media,
+		Caption:         request.Caption,
+		RemoteJID:       jid,
+		Mimetype:        request.Mimetype,
+		ViewOnce:        request.ViewOnce,
+		Quote:           quote,
+		Mentioned:       mentioned,
+		MentionEveryone: request.MentionsEveryOne,
+	}
+
+	var res *whatsmiau.SendVideoResponse
+	send := func(c context.Context) (string, error) {
+		c, err := s.whatsmiau.AllowSend(c, request.InstanceID, *jid)
+		if err != nil {
+			return "", err
+		}
+
+		if err := s.whatsmiau.ChatPresence(&whatsmiau.ChatPresenceRequest{
+			InstanceID: request.InstanceID,
+			RemoteJID:  jid,
+			Presence:   types.ChatPresenceComposing,
+			Media:      types.ChatPresenceMediaText,
+		}); err != nil {
+			zap.L().Error("Whatsmiau.ChatPresence", zap.Error(err))
+		} else {
+			// Delay padrão de 2 segundos para vídeo
+			delay := request.Delay
+			if delay == 0 {
+				delay = 2000 // 2 segundos em millisegundos
+			}
+			time.Sleep(time.Millisecond * time.Duration(delay))
+		}
+
+		res, err = s.whatsmiau.SendVideo(c, sendData)
+		if err != nil {
+			return "", err
 		}
-		time.Sleep(time.Millisecond * time.Duration(delay))
+		return res.ID, nil
 	}
 
-	res, err := s.whatsmiau.SendVideo(c, sendData)
-	if err != nil {
+	if request.Async {
+		return s.enqueue(ctx, request.InstanceID, jid, "videoMessage", send)
+	}
+
+	if _, err := send(ctx.Request().Context()); err != nil {
 		zap.L().Error("Whatsmiau.SendVideo failed", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send video")
+		return sendFail(ctx, err, "failed to send video")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendDocumentResponse{
@@ -357,3 +506,155 @@ func (s *Message) sendVideo(ctx echo.Context, request dto.SendDocumentRequest) e
 		InstanceId:       request.InstanceID,
 	})
 }
+
+// enqueue queues send behind the other async sends of the instance and
+// answers 202 with the job, the result comes in the SEND_MESSAGE event.
+func (s *Message) SendSticker(ctx echo.Context) error {
+	var request dto.SendStickerRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	jid, err := numberToJid(request.Number)
+	if err != nil {
+		zap.L().Error("error converting number to jid", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
+	}
+
+	quote, err := quoteFromRequest(request.Quoted, jid)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid quoted message")
+	}
+
+	mediaURL, data, err := stickerFromRequest(ctx, request.Sticker)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid sticker")
+	}
+
+	sendData := &whatsmiau.SendStickerRequest{
+		InstanceID:    request.InstanceID,
+		MediaURL:      mediaURL,
+		Data:          data,
+		RemoteJID:     jid,
+		PackName:      request.PackName,
+		PackPublisher: request.PackPublisher,
+		Quote:         quote,
+	}
+
+	var res *whatsmiau.SendStickerResponse
+	send := func(c context.Context) (string, error) {
+		c, err := s.whatsmiau.AllowSend(c, request.InstanceID, *jid)
+		if err != nil {
+			return "", err
+		}
+
+		time.Sleep(time.Millisecond * time.Duration(request.Delay))
+
+		res, err = s.whatsmiau.SendSticker(c, sendData)
+		if err != nil {
+			return "", err
+		}
+		return res.ID, nil
+	}
+
+	if request.Async {
+		return s.enqueue(ctx, request.InstanceID, jid, "stickerMessage", send)
+	}
+
+	if _, err := send(ctx.Request().Context()); err != nil {
+		zap.L().Error("Whatsmiau.SendSticker failed", zap.Error(err))
+		return sendFail(ctx, err, "failed to send sticker")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.SendDocumentResponse{
+		Key: dto.MessageResponseKey{
+			RemoteJid: request.Number,
+			FromMe:    true,
+			Id:        res.ID,
+		},
+		Status:           "sent",
+		MessageType:      "stickerMessage",
+		MessageTimestamp: int(res.CreatedAt.Unix()),
+		InstanceId:       request.InstanceID,
+	})
+}
+
+func (s *Message) SendReaction(ctx echo.Context) error {
+	var request dto.SendReactionRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	chat, participant, err := messageKeyJIDs(request.Key.RemoteJid, request.Key.Participant)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid message key")
+	}
+
+	res, err := s.whatsmiau.SendReaction(ctx.Request().Context(), &whatsmiau.SendReactionRequest{
+		InstanceID:  request.InstanceID,
+		RemoteJID:   chat,
+		MessageID:   request.Key.Id,
+		FromMe:      request.Key.FromMe,
+		Participant: participant,
+		Reaction:    request.Reaction,
+	})
+	if err != nil {
+		zap.L().Error("Whatsmiau.SendReaction failed", zap.Error(err))
+		return messageActionFail(ctx, err, "failed to send reaction")
+	}
+
+	return ctx.JSON(http.StatusOK, messageActionResponse(request.InstanceID, request.Key.RemoteJid, "reactionMessage", res.ID, res.CreatedAt))
+}
+
+func (s *Message) enqueue(ctx echo.Context, instanceID string, jid *types.JID, messageType string, send whatsmiau.SendFunc) error {
+	job, err := s.whatsmiau.EnqueueSend(instanceID, *jid, messageType, send)
+	if errors.Is(err, whatsmiau.ErrSendQueueFull) {
+		return utils.HTTPFail(ctx, http.StatusServiceUnavailable, err, "send queue is full")
+	}
+	if err != nil {
+		zap.L().Error("Whatsmiau.EnqueueSend failed", zap.Error(err))
+		return sendFail(ctx, err, "failed to queue send")
+	}
+
+	return ctx.JSON(http.StatusAccepted, sendJobResponse(job))
+}
+
+func (s *Message) GetJob(ctx echo.Context) error {
+	var request dto.GetSendJobRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	job, ok := s.whatsmiau.GetSendJob(request.JobID)
+	if !ok || job.InstanceID != request.InstanceID {
+		return utils.HTTPFail(ctx, http.StatusNotFound, nil, "send job not found")
+	}
+
+	return ctx.JSON(http.StatusOK, sendJobResponse(job))
+}
+
+func sendJobResponse(job *whatsmiau.SendJob) dto.SendJobResponse {
+	return dto.SendJobResponse{
+		ID:          job.ID,
+		InstanceID:  job.InstanceID,
+		RemoteJID:   job.RemoteJID,
+		MessageType: job.MessageType,
+		Status:      job.Status,
+		MessageID:   job.MessageID,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+	}
+}
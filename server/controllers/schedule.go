@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/schedules"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+type Schedules struct {
+	repo      interfaces.ScheduleRepository
+	instances interfaces.InstanceRepository
+}
+
+func NewSchedules(repository interfaces.ScheduleRepository, instances interfaces.InstanceRepository) *Schedules {
+	return &Schedules{
+		repo:      repository,
+		instances: instances,
+	}
+}
+
+func (s *Schedules) Create(ctx echo.Context) error {
+	c := ctx.Request().Context()
+	var request dto.CreateScheduleRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	jid, err := numberToJid(request.Number)
+	if err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid number format")
+	}
+
+	result, err := s.instances.List(c, request.InstanceID)
+	if err != nil {
+		zap.L().Error("failed to list instances", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	}
+
+	if len(result) == 0 {
+		return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+	}
+
+	policy := request.OfflinePolicy
+	if policy == "" {
+		policy = models.OfflinePolicyWait
+	}
+
+	now := time.Now()
+	message := &models.ScheduledMessage{
+		ID:            uuid.NewString(),
+		InstanceID:    request.InstanceID,
+		RemoteJID:     jid.String(),
+		Type:          request.Type,
+		Text:          request.Text,
+		Media:         request.Media,
+		Caption:       request.Caption,
+		FileName:      request.FileName,
+		Mimetype:      request.Mimetype,
+		ViewOnce:      request.ViewOnce,
+		SendAt:        request.SendAt,
+		OfflinePolicy: policy,
+		Status:        models.ScheduledMessagePending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := s.repo.Create(c, message); err != nil {
+		zap.L().Error("failed to schedule message", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to schedule message")
+	}
+
+	return ctx.JSON(http.StatusCreated, scheduleResponse(message))
+}
+
+func (s *Schedules) List(ctx echo.Context) error {
+	var request dto.ListSchedulesRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	messages, err := s.repo.List(ctx.Request().Context(), request.InstanceID)
+	if err != nil {
+		zap.L().Error("failed to list scheduled messages", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list scheduled messages")
+	}
+
+	response := make([]dto.ScheduleResponse, 0, len(messages))
+	for _, message := range messages {
+		if request.Status != "" && string(message.Status) != request.Status {
+			continue
+		}
+		response = append(response, scheduleResponse(&message))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (s *Schedules) Get(ctx echo.Context) error {
+	var request dto.GetScheduleRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	message, err := s.find(ctx.Request().Context(), request.InstanceID, request.ID)
+	if err != nil {
+		if errors.Is(err, schedules.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "scheduled message not found")
+		}
+		zap.L().Error("failed to get scheduled message", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to get scheduled message")
+	}
+
+	return ctx.JSON(http.StatusOK, scheduleResponse(message))
+}
+
+// Reschedule moves a message that was not sent yet, a failed message is
+// scheduled again.
+func (s *Schedules) Reschedule(ctx echo.Context) error {
+	var request dto.RescheduleRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	message, err := s.find(ctx.Request().Context(), request.InstanceID, request.ID)
+	if err != nil {
+		if errors.Is(err, schedules.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "scheduled message not found")
+		}
+		zap.L().Error("failed to get scheduled message", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to get scheduled message")
+	}
+
+	if message.Status == models.ScheduledMessageSent {
+		return utils.HTTPFail(ctx, http.StatusConflict, nil, "scheduled message was already sent")
+	}
+
+	message.SendAt = request.SendAt
+	if request.OfflinePolicy != "" {
+		message.OfflinePolicy = request.OfflinePolicy
+	}
+	message.Status = models.ScheduledMessagePending
+	message.Error = ""
+	message.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx.Request().Context(), message); err != nil {
+		zap.L().Error("failed to reschedule message", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to reschedule message")
+	}
+
+	return ctx.JSON(http.StatusOK, scheduleResponse(message))
+}
+
+// Delete cancels a pending message, or removes a sent or failed one.
+func (s *Schedules) Delete(ctx echo.Context) error {
+	var request dto.GetScheduleRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	_, err := s.find(ctx.Request().Context(), request.InstanceID, request.ID)
+	if err != nil {
+		if errors.Is(err, schedules.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "scheduled message not found")
+		}
+		zap.L().Error("failed to get scheduled message", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to get scheduled message")
+	}
+
+	if err := s.repo.Delete(ctx.Request().Context(), request.ID); err != nil && !errors.Is(err, schedules.ErrorNotFound) {
+		zap.L().Error("failed to delete scheduled message", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to delete scheduled message")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.DeleteScheduleResponse{
+		Message: "scheduled message deleted",
+	})
+}
+
+// find returns a message of the instance, ErrorNotFound when it belongs to
+// another one.
+func (s *Schedules) find(ctx context.Context, instanceID, id string) (*models.ScheduledMessage, error) {
+	message, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if message.InstanceID != instanceID {
+		return nil, schedules.ErrorNotFound
+	}
+
+	return message, nil
+}
+
+func scheduleResponse(message *models.ScheduledMessage) dto.ScheduleResponse {
+	return dto.ScheduleResponse{
+		ID:            message.ID,
+		InstanceID:    message.InstanceID,
+		RemoteJID:     message.RemoteJID,
+		Type:          message.Type,
+		Text:          message.Text,
+		Media:         message.Media,
+		Caption:       message.Caption,
+		FileName:      message.FileName,
+		Mimetype:      message.Mimetype,
+		ViewOnce:      message.ViewOnce,
+		SendAt:        message.SendAt,
+		OfflinePolicy: message.OfflinePolicy,
+		Status:        string(message.Status),
+		MessageID:     message.MessageID,
+		Error:         message.Error,
+		CreatedAt:     message.CreatedAt,
+		UpdatedAt:     message.UpdatedAt,
+	}
+}
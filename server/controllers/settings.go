@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+type Settings struct {
+	repo      interfaces.InstanceRepository
+	whatsmiau *whatsmiau.Whatsmiau
+}
+
+func NewSettings(repository interfaces.InstanceRepository, whatsmiau *whatsmiau.Whatsmiau) *Settings {
+	return &Settings{
+		repo:      repository,
+		whatsmiau: whatsmiau,
+	}
+}
+
+func (s *Settings) Set(ctx echo.Context) error {
+	var request dto.SetSettingsRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	instance, err := s.update(ctx.Request().Context(), request.InstanceID, &models.InstanceUpdate{
+		RejectCall:      request.RejectCall,
+		MsgCall:         request.MsgCall,
+		GroupsIgnore:    request.GroupsIgnore,
+		AlwaysOnline:    request.AlwaysOnline,
+		ReadMessages:    request.ReadMessages,
+		ReadStatus:      request.ReadStatus,
+		SyncFullHistory: request.SyncFullHistory,
+	})
+	if err != nil {
+		if errors.Is(err, instances.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+		}
+		zap.L().Error("failed to update instance", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to update instance")
+	}
+
+	return ctx.JSON(http.StatusCreated, settingsResponse(instance))
+}
+
+func (s *Settings) Find(ctx echo.Context) error {
+	var request dto.FindSettingsRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	instance, err := s.find(ctx.Request().Context(), request.InstanceID)
+	if err != nil {
+		if errors.Is(err, instances.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+		}
+		zap.L().Error("failed to list instances", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	}
+
+	return ctx.JSON(http.StatusOK, settingsResponse(instance))
+}
+
+func (s *Settings) SetWebhook(ctx echo.Context) error {
+	var request dto.SetWebhookRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	settings := request.WebhookSettings
+	if request.Webhook != nil {
+		settings = *request.Webhook
+	}
+
+	update := &models.InstanceWebhookUpdate{
+		Url:      settings.Url,
+		Headers:  settings.Headers,
+		ByEvents: settings.ByEvents,
+		Base64:   settings.Base64,
+		Events:   settings.Events,
+	}
+	if settings.Enabled != nil && !*settings.Enabled {
+		update.Url = new(string)
+	}
+
+	instance, err := s.update(ctx.Request().Context(), request.InstanceID, &models.InstanceUpdate{
+		Webhook: update,
+	})
+	if err != nil {
+		if errors.Is(err, instances.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+		}
+		zap.L().Error("failed to update instance", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to update instance")
+	}
+
+	return ctx.JSON(http.StatusCreated, webhookResponse(instance))
+}
+
+func (s *Settings) FindWebhook(ctx echo.Context) error {
+	var request dto.FindWebhookRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	instance, err := s.find(ctx.Request().Context(), request.InstanceID)
+	if err != nil {
+		if errors.Is(err, instances.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "instance not found")
+		}
+		zap.L().Error("failed to list instances", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list instances")
+	}
+
+	return ctx.JSON(http.StatusOK, webhookResponse(instance))
+}
+
+func (s *Settings) update(ctx context.Context, id string, update *models.InstanceUpdate) (*models.Instance, error) {
+	instance, err := s.repo.Update(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+
+	s.whatsmiau.ReloadInstance(id)
+	return instance, nil
+}
+
+func (s *Settings) find(ctx context.Context, id string) (*models.Instance, error) {
+	result, err := s.repo.List(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, instances.ErrorNotFound
+	}
+
+	return &result[0], nil
+}
+
+func settingsResponse(instance *models.Instance) dto.SettingsResponse {
+	return dto.SettingsResponse{
+		RejectCall:      instance.RejectCall,
+		MsgCall:         instance.MsgCall,
+		GroupsIgnore:    instance.GroupsIgnore,
+		AlwaysOnline:    instance.AlwaysOnline,
+		ReadMessages:    instance.ReadMessages,
+		ReadStatus:      instance.ReadStatus,
+		SyncFullHistory: instance.SyncFullHistory,
+	}
+}
+
+func webhookResponse(instance *models.Instance) dto.WebhookResponse {
+	events := instance.Webhook.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	return dto.WebhookResponse{
+		Enabled:         len(instance.Webhook.Url) > 0,
+		Url:             instance.Webhook.Url,
+		Headers:         instance.Webhook.Headers,
+		WebhookByEvents: instance.Webhook.ByEvents,
+		WebhookBase64:   instance.Webhook.Base64 != nil && *instance.Webhook.Base64,
+		Events:          events,
+	}
+}
@@ -39,7 +39,7 @@ func (s *Status) SendText(ctx echo.Context) error {
 
 	if err != nil {
 		zap.L().Error("failed to send status text", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send status text")
+		return sendFail(ctx, err, "failed to send status text")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendStatusResponse{
@@ -71,7 +71,7 @@ func (s *Status) SendImage(ctx echo.Context) error {
 
 	if err != nil {
 		zap.L().Error("failed to send status image", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send status image")
+		return sendFail(ctx, err, "failed to send status image")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendStatusResponse{
@@ -103,7 +103,7 @@ func (s *Status) SendVideo(ctx echo.Context) error {
 
 	if err != nil {
 		zap.L().Error("failed to send status video", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send status video")
+		return sendFail(ctx, err, "failed to send status video")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendStatusResponse{
@@ -134,7 +134,7 @@ func (s *Status) SendAudio(ctx echo.Context) error {
 
 	if err != nil {
 		zap.L().Error("failed to send status audio", zap.Error(err))
-		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to send status audio")
+		return sendFail(ctx, err, "failed to send status audio")
 	}
 
 	return ctx.JSON(http.StatusOK, dto.SendStatusResponse{
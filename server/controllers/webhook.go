@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/interfaces"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/webhooks"
+	"github.com/verbeux-ai/whatsmiau/server/dto"
+	"github.com/verbeux-ai/whatsmiau/utils"
+	"go.uber.org/zap"
+)
+
+type Webhook struct {
+	repo      interfaces.InstanceRepository
+	whatsmiau *whatsmiau.Whatsmiau
+}
+
+func NewWebhooks(repository interfaces.InstanceRepository, whatsmiau *whatsmiau.Whatsmiau) *Webhook {
+	return &Webhook{
+		repo:      repository,
+		whatsmiau: whatsmiau,
+	}
+}
+
+func (s *Webhook) ListDeliveries(ctx echo.Context) error {
+	var request dto.ListWebhookDeliveriesRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	result, err := s.whatsmiau.ListWebhookDeliveries(ctx.Request().Context(), models.WebhookDeliveryFilter{
+		InstanceID: request.ID,
+		Status:     models.WebhookDeliveryStatus(request.Status),
+		From:       request.From,
+		To:         request.To,
+		Limit:      request.Limit,
+	})
+	if err != nil {
+		zap.L().Error("failed to list webhook deliveries", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to list webhook deliveries")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.ListWebhookDeliveriesResponse{
+		Deliveries: result,
+	})
+}
+
+func (s *Webhook) GetDelivery(ctx echo.Context) error {
+	var request dto.WebhookDeliveryRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	delivery, err := s.whatsmiau.GetWebhookDelivery(ctx.Request().Context(), request.ID, request.DeliveryID)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "webhook delivery not found")
+		}
+		zap.L().Error("failed to get webhook delivery", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to get webhook delivery")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.WebhookDeliveryResponse{
+		WebhookDelivery: delivery,
+	})
+}
+
+func (s *Webhook) ReplayDelivery(ctx echo.Context) error {
+	var request dto.WebhookDeliveryRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	delivery, err := s.whatsmiau.ReplayWebhookDelivery(ctx.Request().Context(), request.ID, request.DeliveryID)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "webhook delivery not found")
+		}
+		zap.L().Error("failed to replay webhook delivery", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to replay webhook delivery")
+	}
+
+	return ctx.JSON(http.StatusAccepted, dto.WebhookDeliveryResponse{
+		WebhookDelivery: delivery,
+	})
+}
+
+func (s *Webhook) ReplayDeliveries(ctx echo.Context) error {
+	var request dto.ReplayWebhookDeliveriesRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	if request.Status == "" {
+		request.Status = string(models.WebhookDeliveryFailed)
+	}
+
+	result, err := s.whatsmiau.ReplayWebhookDeliveries(ctx.Request().Context(), models.WebhookDeliveryFilter{
+		InstanceID: request.ID,
+		Status:     models.WebhookDeliveryStatus(request.Status),
+		From:       request.From,
+		To:         request.To,
+	})
+	if err != nil {
+		zap.L().Error("failed to replay webhook deliveries", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to replay webhook deliveries")
+	}
+
+	return ctx.JSON(http.StatusAccepted, dto.ReplayWebhookDeliveriesResponse{
+		Replayed: len(result),
+	})
+}
+
+func (s *Webhook) DeleteDelivery(ctx echo.Context) error {
+	var request dto.WebhookDeliveryRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	if err := s.whatsmiau.DeleteWebhookDelivery(ctx.Request().Context(), request.ID, request.DeliveryID); err != nil {
+		if errors.Is(err, webhooks.ErrorNotFound) {
+			return utils.HTTPFail(ctx, http.StatusNotFound, err, "webhook delivery not found")
+		}
+		zap.L().Error("failed to delete webhook delivery", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to delete webhook delivery")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.PurgeWebhookDeliveriesResponse{
+		Purged: 1,
+	})
+}
+
+func (s *Webhook) PurgeDeliveries(ctx echo.Context) error {
+	var request dto.PurgeWebhookDeliveriesRequest
+	if err := ctx.Bind(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusUnprocessableEntity, err, "failed to bind request body")
+	}
+
+	if err := validator.New().Struct(&request); err != nil {
+		return utils.HTTPFail(ctx, http.StatusBadRequest, err, "invalid request body")
+	}
+
+	purged, err := s.whatsmiau.PurgeWebhookDeliveries(ctx.Request().Context(), models.WebhookDeliveryFilter{
+		InstanceID: request.ID,
+		Status:     models.WebhookDeliveryStatus(request.Status),
+		From:       request.From,
+		To:         request.To,
+	})
+	if err != nil {
+		zap.L().Error("failed to purge webhook deliveries", zap.Error(err))
+		return utils.HTTPFail(ctx, http.StatusInternalServerError, err, "failed to purge webhook deliveries")
+	}
+
+	return ctx.JSON(http.StatusOK, dto.PurgeWebhookDeliveriesResponse{
+		Purged: purged,
+	})
+}
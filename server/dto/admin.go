@@ -0,0 +1,20 @@
+package dto
+
+import "github.com/verbeux-ai/whatsmiau/models"
+
+type ListUnmatchedDevicesResponse struct {
+	Devices []models.UnmatchedDevice `json:"devices"`
+}
+
+type AdoptUnmatchedDeviceRequest struct {
+	JID        string `param:"jid" validate:"required"`
+	InstanceID string `json:"instanceId" validate:"required"`
+}
+
+type LogoutUnmatchedDeviceRequest struct {
+	JID string `param:"jid" validate:"required"`
+}
+
+type UnmatchedDeviceResponse struct {
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+type ListApiKeysRequest struct {
+	InstanceID string `query:"instanceId"`
+}
+
+type CreateApiKeyRequest struct {
+	Name       string   `json:"name,omitempty"`
+	InstanceID string   `json:"instanceId,omitempty"` // restricts the key to this instance
+	Scopes     []string `json:"scopes" validate:"required,min=1,dive,oneof=read send admin"`
+}
+
+type DeleteApiKeyRequest struct {
+	ID string `param:"keyId" validate:"required"`
+}
+
+type ApiKeyResponse struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	InstanceID string    `json:"instanceId,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Token      string    `json:"token,omitempty"` // only returned on creation
+}
+
+type DeleteApiKeyResponse struct {
+	Message string `json:"message,omitempty"`
+}
@@ -40,3 +40,19 @@ type SendChatPresenceResponse struct {
 type NumberExistsRequest struct {
 	Numbers []string `json:"numbers"     validate:"required,min=1,dive,required"`
 }
+
+type UpdateMessageRequest struct {
+	InstanceID       string     `param:"instance" validate:"required"`
+	Number           string     `json:"number"`
+	Key              MessageKey `json:"key"`
+	Text             string     `json:"text" validate:"required"`
+	MessageTimestamp int64      `json:"messageTimestamp,omitempty"` // unix seconds, checked against the edit window
+}
+
+type DeleteMessageRequest struct {
+	InstanceID  string `param:"instance" validate:"required"`
+	Id          string `json:"id" validate:"required"`
+	RemoteJid   string `json:"remoteJid" validate:"required"`
+	FromMe      bool   `json:"fromMe,omitempty"`
+	Participant string `json:"participant,omitempty"`
+}
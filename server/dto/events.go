@@ -0,0 +1,29 @@
+package dto
+
+import "encoding/json"
+
+type EventStreamRequest struct {
+	ID string `param:"id"` // empty streams every instance
+}
+
+// EventStreamSubscribe is the first message a client sends after connecting.
+type EventStreamSubscribe struct {
+	Events []string `json:"events,omitempty"` // MESSAGES_UPSERT, messages.update...; empty means all
+	Cursor uint64   `json:"cursor,omitempty"` // resume after this cursor
+}
+
+const (
+	EventStreamFrameSubscribed = "subscribed"
+	EventStreamFrameEvent      = "event"
+	EventStreamFrameError      = "error"
+)
+
+type EventStreamFrame struct {
+	Type     string          `json:"type"`
+	Cursor   uint64          `json:"cursor,omitempty"`
+	Instance string          `json:"instance,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Complete *bool           `json:"complete,omitempty"` // false when events after the requested cursor were lost
+	Message  string          `json:"message,omitempty"`
+}
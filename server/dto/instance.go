@@ -1,22 +1,26 @@
 package dto
 
-import "github.com/verbeux-ai/whatsmiau/models"
+import (
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+)
 
 type CreateInstanceRequest struct {
 	ID               string `json:"id,omitempty" validate:"required_without=InstanceName"`
 	InstanceName     string `json:"instanceName,omitempty" validate:"required_without=InstanceID"`
+	Token            string `json:"token,omitempty"` // instance api key, generated when empty
 	*models.Instance        // optional arguments
 }
 
 type CreateInstanceResponse struct {
 	*models.Instance
+	Hash string `json:"hash,omitempty"` // instance api key, only returned here
 }
 
 type UpdateInstanceRequest struct {
-	ID      string `json:"id,omitempty" param:"id" validate:"required"`
-	Webhook struct {
-		Base64 bool `json:"base64,omitempty"`
-	} `json:"webhook,omitempty"`
+	ID string `json:"id,omitempty" param:"id" validate:"required"`
+	models.InstanceUpdate
 }
 
 type UpdateInstanceResponse struct {
@@ -26,6 +30,12 @@ type UpdateInstanceResponse struct {
 type ListInstancesRequest struct {
 	InstanceName string `query:"instanceName"`
 	ID           string `query:"id"`
+	Status       string `query:"status"`
+	OwnerJID     string `query:"ownerJid"`
+	Tag          string `query:"tag"`
+	Cursor       string `query:"cursor"`
+	Limit        int    `query:"limit" validate:"min=0,max=1000"`
+	Count        bool   `query:"count"`
 }
 
 type ListInstancesResponse struct {
@@ -54,6 +64,7 @@ type StatusInstanceResponse struct {
 	ID        string                                        `json:"id,omitempty"`
 	Status    string                                        `json:"state,omitempty"`
 	RemoteJID string                                        `json:"remoteJid,omitempty"`
+	Reason    string                                        `json:"reason,omitempty"` // why the instance is in backoff or failed
 	Instance  *StatusInstanceResponseEvolutionCompatibility `json:"instance,omitempty"`
 }
 
@@ -70,6 +81,15 @@ type DeleteInstanceResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+type RestartInstanceRequest struct {
+	ID string `param:"id" validate:"required"`
+}
+
+type RestartInstanceResponse struct {
+	Message string `json:"message,omitempty"`
+	State   string `json:"state,omitempty"`
+}
+
 type LogoutInstanceRequest struct {
 	ID string `param:"id" validate:"required"`
 }
@@ -115,3 +135,14 @@ type UpdateReadSettingsRequest struct {
 type UpdateReadSettingsResponse struct {
 	*models.Instance
 }
+
+// ConnectStreamEvent is the data of each server-sent event of the connect stream.
+type ConnectStreamEvent struct {
+	Code        string    `json:"code,omitempty"`
+	Base64      string    `json:"base64,omitempty"` // QR code PNG as a data uri
+	PairingCode string    `json:"pairingCode,omitempty"`
+	State       string    `json:"state,omitempty"`
+	RemoteJID   string    `json:"remoteJid,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	DateTime    time.Time `json:"dateTime"`
+}
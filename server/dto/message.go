@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type SendTextRequest struct {
 	InstanceID       string                `param:"instance" validate:"required"`
 	Number           string                `json:"number,omitempty" validate:"required"` // JID
@@ -9,19 +14,30 @@ type SendTextRequest struct {
 	LinkPreview      bool                  `json:"linkPreview,omitempty"`
 	MentionsEveryOne bool                  `json:"mentionsEveryOne,omitempty"`
 	Mentioned        []string              `json:"mentioned,omitempty"`
+	Async            bool                  `json:"async,omitempty"` // queue the send and answer 202 with the job
 }
 
+// MessageRequestQuoted is the message a send replies to, as Evolution sends it.
 type MessageRequestQuoted struct {
-	Key     QuotedKey     `json:"key,omitempty"`
-	Message QuotedMessage `json:"message,omitempty"`
+	Key QuotedKey `json:"key,omitempty"`
+	// Message is the quoted content in the WhatsApp JSON format, like
+	// {"conversation": "..."} or {"imageMessage": {"caption": "..."}}
+	Message json.RawMessage `json:"message,omitempty"`
 }
 
 type QuotedKey struct {
-	Id string `json:"id,omitempty"`
+	Id          string `json:"id,omitempty"`
+	RemoteJid   string `json:"remoteJid,omitempty"`   // chat of the quoted message, defaults to the number
+	FromMe      bool   `json:"fromMe,omitempty"`      // quoting a message sent by the instance
+	Participant string `json:"participant,omitempty"` // who sent the quoted message, required in groups
 }
 
-type QuotedMessage struct {
-	Conversation string `json:"conversation,omitempty"`
+// MessageKey identifies an existing message, as Evolution sends it.
+type MessageKey struct {
+	RemoteJid   string `json:"remoteJid"`
+	FromMe      bool   `json:"fromMe,omitempty"`
+	Id          string `json:"id" validate:"required"`
+	Participant string `json:"participant,omitempty"` // who sent the message, required in groups
 }
 
 type MessageResponseKey struct {
@@ -66,6 +82,7 @@ type SendAudioRequest struct {
 	MentionsEveryOne bool                  `json:"mentionsEveryOne,omitempty"`
 	Mentioned        []string              `json:"mentioned,omitempty"`
 	Encoding         bool                  `json:"encoding,omitempty"`
+	Async            bool                  `json:"async,omitempty"`
 }
 
 type SendAudioResponseMessage struct {
@@ -140,6 +157,7 @@ type SendDocumentRequest struct {
 	Quoted           *MessageRequestQuoted `json:"quoted,omitempty"`
 	MentionsEveryOne bool                  `json:"mentionsEveryOne,omitempty"`
 	Mentioned        []string              `json:"mentioned,omitempty"`
+	Async            bool                  `json:"async,omitempty"`
 }
 
 type SendDocumentResponse struct {
@@ -173,3 +191,48 @@ type SendDocumentResponseDataImage struct {
 	JpegThumbnail     string `json:"jpegThumbnail,omitempty"`
 	ContextInfo       any    `json:"contextInfo,omitempty"`
 }
+
+type SendStickerRequest struct {
+	InstanceID string `param:"instance"`
+	Number     string `json:"number,omitempty" form:"number"`
+	// Sticker is the URL or base64 of a PNG, JPEG, GIF or WebP image, or the
+	// file itself in a multipart upload
+	Sticker       string                `json:"sticker,omitempty" form:"sticker"`
+	PackName      string                `json:"packName,omitempty" form:"packName"`
+	PackPublisher string                `json:"packPublisher,omitempty" form:"packPublisher"`
+	Delay         int                   `json:"delay,omitempty" form:"delay" validate:"omitempty,min=0,max=300000"`
+	Quoted        *MessageRequestQuoted `json:"quoted,omitempty"`
+	Async         bool                  `json:"async,omitempty" form:"async"`
+}
+
+type GetSendJobRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+	JobID      string `param:"jobId" validate:"required"`
+}
+
+type SendJobResponse struct {
+	ID          string    `json:"id"`
+	InstanceID  string    `json:"instanceId"`
+	RemoteJID   string    `json:"remoteJid"`
+	MessageType string    `json:"messageType"`
+	Status      string    `json:"status"` // queued, running, sent or failed
+	MessageID   string    `json:"messageId,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type SendReactionRequest struct {
+	InstanceID string     `param:"instance" validate:"required"`
+	Key        MessageKey `json:"key"`
+	Reaction   string     `json:"reaction"` // an emoji, empty removes the reaction
+}
+
+// MessageActionResponse answers reactions, edits and revokes.
+type MessageActionResponse struct {
+	Key              MessageResponseKey `json:"key"`
+	Status           string             `json:"status"`
+	MessageType      string             `json:"messageType"`
+	MessageTimestamp int                `json:"messageTimestamp"`
+	InstanceId       string             `json:"instanceId"`
+}
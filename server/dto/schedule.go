@@ -0,0 +1,59 @@
+package dto
+
+import "time"
+
+type CreateScheduleRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+	Type       string `json:"type" validate:"required,oneof=text audio document image video"`
+	Number     string `json:"number" validate:"required"` // JID
+	Text       string `json:"text,omitempty" validate:"required_if=Type text"`
+	// Media is the URL of the file, downloaded when the message is sent
+	Media         string    `json:"media,omitempty" validate:"required_unless=Type text"`
+	Caption       string    `json:"caption,omitempty"`
+	FileName      string    `json:"fileName,omitempty"`
+	Mimetype      string    `json:"mimetype,omitempty"`
+	ViewOnce      bool      `json:"viewOnce,omitempty"`
+	SendAt        time.Time `json:"sendAt" validate:"required"`
+	OfflinePolicy string    `json:"offlinePolicy,omitempty" validate:"omitempty,oneof=wait fail"` // defaults to wait
+}
+
+type ListSchedulesRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+	Status     string `query:"status" validate:"omitempty,oneof=pending sent failed"`
+}
+
+type GetScheduleRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+	ID         string `param:"scheduleId" validate:"required"`
+}
+
+type RescheduleRequest struct {
+	InstanceID    string    `param:"instance" validate:"required"`
+	ID            string    `param:"scheduleId" validate:"required"`
+	SendAt        time.Time `json:"sendAt" validate:"required"`
+	OfflinePolicy string    `json:"offlinePolicy,omitempty" validate:"omitempty,oneof=wait fail"`
+}
+
+type ScheduleResponse struct {
+	ID            string    `json:"id"`
+	InstanceID    string    `json:"instanceId"`
+	RemoteJID     string    `json:"remoteJid"`
+	Type          string    `json:"type"`
+	Text          string    `json:"text,omitempty"`
+	Media         string    `json:"media,omitempty"`
+	Caption       string    `json:"caption,omitempty"`
+	FileName      string    `json:"fileName,omitempty"`
+	Mimetype      string    `json:"mimetype,omitempty"`
+	ViewOnce      bool      `json:"viewOnce,omitempty"`
+	SendAt        time.Time `json:"sendAt"`
+	OfflinePolicy string    `json:"offlinePolicy"`
+	Status        string    `json:"status"` // pending, sent or failed
+	MessageID     string    `json:"messageId,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type DeleteScheduleResponse struct {
+	Message string `json:"message,omitempty"`
+}
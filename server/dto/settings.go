@@ -0,0 +1,60 @@
+package dto
+
+import "github.com/verbeux-ai/whatsmiau/models"
+
+type FindSettingsRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+}
+
+type SetSettingsRequest struct {
+	InstanceID      string  `param:"instance" validate:"required"`
+	RejectCall      *bool   `json:"rejectCall,omitempty"`
+	MsgCall         *string `json:"msgCall,omitempty"`
+	GroupsIgnore    *bool   `json:"groupsIgnore,omitempty"`
+	AlwaysOnline    *bool   `json:"alwaysOnline,omitempty"`
+	ReadMessages    *bool   `json:"readMessages,omitempty"`
+	ReadStatus      *bool   `json:"readStatus,omitempty"`
+	SyncFullHistory *bool   `json:"syncFullHistory,omitempty"`
+}
+
+type SettingsResponse struct {
+	RejectCall      bool   `json:"rejectCall"`
+	MsgCall         string `json:"msgCall"`
+	GroupsIgnore    bool   `json:"groupsIgnore"`
+	AlwaysOnline    bool   `json:"alwaysOnline"`
+	ReadMessages    bool   `json:"readMessages"`
+	ReadStatus      bool   `json:"readStatus"`
+	SyncFullHistory bool   `json:"syncFullHistory"`
+}
+
+type FindWebhookRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+}
+
+// WebhookSettings follows Evolution's webhook/set body; enabled false clears
+// the url.
+type WebhookSettings struct {
+	Enabled  *bool                          `json:"enabled,omitempty"`
+	Url      *string                        `json:"url,omitempty"`
+	Headers  *models.InstanceWebhookHeaders `json:"headers,omitempty"`
+	ByEvents *bool                          `json:"byEvents,omitempty"`
+	Base64   *bool                          `json:"base64,omitempty"`
+	Events   *[]string                      `json:"events,omitempty"`
+}
+
+// SetWebhookRequest accepts the settings at the root (Evolution v1) or
+// inside "webhook" (Evolution v2).
+type SetWebhookRequest struct {
+	InstanceID string `param:"instance" validate:"required"`
+	WebhookSettings
+	Webhook *WebhookSettings `json:"webhook,omitempty"`
+}
+
+type WebhookResponse struct {
+	Enabled         bool                          `json:"enabled"`
+	Url             string                        `json:"url"`
+	Headers         models.InstanceWebhookHeaders `json:"headers"`
+	WebhookByEvents bool                          `json:"webhookByEvents"`
+	WebhookBase64   bool                          `json:"webhookBase64"`
+	Events          []string                      `json:"events"`
+}
@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/models"
+)
+
+type ListWebhookDeliveriesRequest struct {
+	ID     string    `param:"id" validate:"required"`
+	Status string    `query:"status" validate:"omitempty,oneof=pending failed"`
+	From   time.Time `query:"from"` // RFC3339
+	To     time.Time `query:"to"`   // RFC3339
+	Limit  int64     `query:"limit" validate:"omitempty,min=1"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+type WebhookDeliveryRequest struct {
+	ID         string `param:"id" validate:"required"`
+	DeliveryID string `param:"deliveryId" validate:"required"`
+}
+
+type WebhookDeliveryResponse struct {
+	*models.WebhookDelivery
+}
+
+type ReplayWebhookDeliveriesRequest struct {
+	ID     string    `param:"id" validate:"required"`
+	Status string    `json:"status,omitempty" validate:"omitempty,oneof=pending failed"` // defaults to failed
+	From   time.Time `json:"from,omitempty"`
+	To     time.Time `json:"to,omitempty"`
+}
+
+type ReplayWebhookDeliveriesResponse struct {
+	Replayed int `json:"replayed"`
+}
+
+type PurgeWebhookDeliveriesRequest struct {
+	ID     string    `param:"id" validate:"required"`
+	Status string    `query:"status" validate:"omitempty,oneof=pending failed"`
+	From   time.Time `query:"from"`
+	To     time.Time `query:"to"`
+}
+
+type PurgeWebhookDeliveriesResponse struct {
+	Purged int `json:"purged"`
+}
@@ -1,25 +1,117 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/verbeux-ai/whatsmiau/env"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/apikeys"
+	"go.uber.org/zap"
 )
 
+const apiKeyContext = "apikey"
+
+// masterKey stands for the global API_KEY.
+var masterKey = &models.ApiKey{
+	Scopes: []string{models.ScopeAdmin},
+}
+
+// Auth accepts the global API_KEY or a stored key, which routes then check
+// with Require.
 func Auth(ctx echo.Context, next echo.HandlerFunc) error {
 	gotApikey := ctx.Request().Header.Get("apikey")
+	if len(gotApikey) == 0 && ctx.IsWebSocket() {
+		// browsers cannot set headers on a websocket handshake
+		gotApikey = ctx.QueryParam("apikey")
+	}
 	if len(env.Env.ApiKey) == 0 {
 		return next(ctx)
 	}
 
-	if gotApikey != env.Env.ApiKey {
+	if len(gotApikey) == 0 {
+		return echo.NewHTTPError(http.StatusUnauthorized)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(gotApikey), []byte(env.Env.ApiKey)) == 1 {
+		ctx.Set(apiKeyContext, masterKey)
+		return next(ctx)
+	}
+
+	key, err := apikeys.Lookup(ctx.Request().Context(), apikeys.Get(), gotApikey)
+	if err != nil {
+		if !errors.Is(err, apikeys.ErrorNotFound) {
+			zap.L().Error("failed to look api key up", zap.Error(err))
+		}
 		return echo.NewHTTPError(http.StatusUnauthorized)
 	}
 
+	ctx.Set(apiKeyContext, key)
 	return next(ctx)
 }
 
+// Require restricts a route to keys granting scope. Keys bound to an instance
+// are also restricted to routes of that instance, given by the :instance or
+// :id param.
+func Require(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			key, ok := ctx.Get(apiKeyContext).(*models.ApiKey)
+			if !ok {
+				// API_KEY is not set
+				return next(ctx)
+			}
+
+			if !key.Allows(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "api key lacks the "+scope+" scope")
+			}
+
+			if key.InstanceID == "" {
+				return next(ctx)
+			}
+
+			instance := ctx.Param("instance")
+			if instance == "" {
+				instance = ctx.Param("id")
+			}
+			if instance != key.InstanceID {
+				return echo.NewHTTPError(http.StatusForbidden, "api key is restricted to another instance")
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// RequireFiltered restricts a route serving every instance, such as the
+// instance list, to keys granting scope. Keys bound to an instance are let
+// through, the route narrowing its answer to KeyInstance.
+func RequireFiltered(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			key, ok := ctx.Get(apiKeyContext).(*models.ApiKey)
+			if ok && !key.Allows(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "api key lacks the "+scope+" scope")
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// KeyInstance returns the instance the API key of the request is restricted
+// to, empty when it can access every instance.
+func KeyInstance(ctx echo.Context) string {
+	key, ok := ctx.Get(apiKeyContext).(*models.ApiKey)
+	if !ok {
+		return ""
+	}
+
+	return key.InstanceID
+}
+
 type simplifiedMiddleware func(c echo.Context, next echo.HandlerFunc) error
 
 func Simplify(handler simplifiedMiddleware) func(next echo.HandlerFunc) echo.HandlerFunc {
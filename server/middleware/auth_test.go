@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/models"
+)
+
+// testServer serves /instance, listing instances, and /instance/:id, both
+// answering with the instance the key is bound to.
+func testServer(key *models.ApiKey) *echo.Echo {
+	app := echo.New()
+	app.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if key != nil {
+				ctx.Set(apiKeyContext, key)
+			}
+			return next(ctx)
+		}
+	})
+
+	handler := func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, KeyInstance(ctx))
+	}
+	app.GET("/instance", handler, RequireFiltered(models.ScopeRead))
+	app.GET("/instance/:id", handler, Require(models.ScopeRead))
+	app.POST("/instance", handler, Require(models.ScopeAdmin))
+
+	return app
+}
+
+func TestRequire(t *testing.T) {
+	scoped := &models.ApiKey{InstanceID: "a", Scopes: []string{models.ScopeRead, models.ScopeSend}}
+	sendOnly := &models.ApiKey{InstanceID: "a", Scopes: []string{models.ScopeSend}}
+
+	tests := []struct {
+		name     string
+		key      *models.ApiKey
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"no api key configured", nil, http.MethodGet, "/instance", http.StatusOK, ""},
+		{"master key lists every instance", masterKey, http.MethodGet, "/instance", http.StatusOK, ""},
+		{"scoped key lists its instance", scoped, http.MethodGet, "/instance", http.StatusOK, "a"},
+		{"scoped key without the scope", sendOnly, http.MethodGet, "/instance", http.StatusForbidden, ""},
+		{"scoped key on its instance", scoped, http.MethodGet, "/instance/a", http.StatusOK, "a"},
+		{"scoped key on another instance", scoped, http.MethodGet, "/instance/b", http.StatusForbidden, ""},
+		{"scoped key never gets admin", scoped, http.MethodPost, "/instance", http.StatusForbidden, ""},
+		{"master key gets admin", masterKey, http.MethodPost, "/instance", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			testServer(tt.key).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.wantBody {
+				t.Fatalf("key instance %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
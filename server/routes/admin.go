@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+)
+
+func Admin(group *echo.Group) {
+	instanceRepo := instances.Get()
+	controller := controllers.NewAdmin(instanceRepo, whatsmiau.Get())
+	group.Use(middleware.Require(models.ScopeAdmin))
+
+	group.GET("/devices/unmatched", controller.ListUnmatchedDevices)
+	group.POST("/devices/unmatched/:jid/adopt", controller.AdoptUnmatchedDevice)
+	group.POST("/devices/unmatched/:jid/logout", controller.LogoutUnmatchedDevice)
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/apikeys"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+)
+
+func ApiKeys(group *echo.Group) {
+	controller := controllers.NewApiKeys(apikeys.Get(), instances.Get())
+	group.Use(middleware.Require(models.ScopeAdmin))
+
+	group.GET("", controller.List)
+	group.POST("", controller.Create)
+	group.DELETE("/:keyId", controller.Delete)
+}
@@ -3,25 +3,30 @@ package routes
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
 	"github.com/verbeux-ai/whatsmiau/repositories/instances"
 	"github.com/verbeux-ai/whatsmiau/server/controllers"
-	"github.com/verbeux-ai/whatsmiau/services"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
 )
 
 func Chat(group *echo.Group) {
-	redisInstance := instances.NewRedis(services.Redis())
-	controller := controllers.NewChats(redisInstance, whatsmiau.Get())
+	instanceRepo := instances.Get()
+	controller := controllers.NewChats(instanceRepo, whatsmiau.Get())
+	send := middleware.Require(models.ScopeSend)
 
-	group.POST("/presence", controller.SendChatPresence)
-	group.POST("/read-messages", controller.ReadMessages)
+	group.POST("/presence", controller.SendChatPresence, send)
+	group.POST("/read-messages", controller.ReadMessages, send)
 }
 
 func ChatEVO(group *echo.Group) {
-	redisInstance := instances.NewRedis(services.Redis())
-	controller := controllers.NewChats(redisInstance, whatsmiau.Get())
+	instanceRepo := instances.Get()
+	controller := controllers.NewChats(instanceRepo, whatsmiau.Get())
+	read, send := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeSend)
 
 	// Evolution API Compatibility (partially REST)
-	group.POST("/markMessageAsRead/:instance", controller.ReadMessages)
-	group.POST("/sendPresence/:instance", controller.SendChatPresence)
-	group.POST("/whatsappNumbers/:instance", controller.NumberExists)
+	group.POST("/markMessageAsRead/:instance", controller.ReadMessages, send)
+	group.POST("/sendPresence/:instance", controller.SendChatPresence, send)
+	group.POST("/whatsappNumbers/:instance", controller.NumberExists, read)
+	group.POST("/updateMessage/:instance", controller.UpdateMessage, send)
+	group.DELETE("/deleteMessageForEveryone/:instance", controller.DeleteMessageForEveryone, send)
 }
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+)
+
+func Events(group *echo.Group) {
+	instanceRepo := instances.Get()
+	controller := controllers.NewEvents(instanceRepo, whatsmiau.Get())
+
+	group.GET("/ws", controller.Stream, middleware.Require(models.ScopeRead))
+}
+
+// AllEvents streams the events of every instance, or only those of its
+// instance to a key bound to one.
+func AllEvents(group *echo.Group) {
+	instanceRepo := instances.Get()
+	controller := controllers.NewEvents(instanceRepo, whatsmiau.Get())
+
+	group.GET("/ws", controller.Stream, middleware.RequireFiltered(models.ScopeRead))
+}
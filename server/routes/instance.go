@@ -3,32 +3,40 @@ package routes
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/apikeys"
 	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/repositories/schedules"
 	"github.com/verbeux-ai/whatsmiau/server/controllers"
-	"github.com/verbeux-ai/whatsmiau/services"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
 )
 
 func Instance(group *echo.Group) {
-	redisInstance := instances.NewRedis(services.Redis())
+	instanceRepo := instances.Get()
+	read, admin := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeAdmin)
+	list := middleware.RequireFiltered(models.ScopeRead)
 
-	controller := controllers.NewInstances(redisInstance, whatsmiau.Get())
-	group.POST("", controller.Create)
-	group.GET("", controller.List)
-	group.POST("/:id/connect", controller.Connect)
-	group.POST("/:id/pairing/start", controller.StartPairing)
-	group.GET("/:id/pairing/status", controller.GetPairingStatus)
-	group.POST("/:id/logout", controller.Logout)
-	group.DELETE("/:id", controller.Delete)
-	group.GET("/:id/status", controller.Status)
-	group.PUT("/:id/read-settings", controller.UpdateReadSettings)
+	controller := controllers.NewInstances(instanceRepo, apikeys.Get(), schedules.Get(), whatsmiau.Get())
+	group.POST("", controller.Create, admin)
+	group.GET("", controller.List, list)
+	group.POST("/:id/connect", controller.Connect, admin)
+	group.GET("/:id/connect/stream", controller.ConnectStream, admin)
+	group.POST("/:id/pairing/start", controller.StartPairing, admin)
+	group.GET("/:id/pairing/status", controller.GetPairingStatus, read)
+	group.POST("/:id/logout", controller.Logout, admin)
+	group.POST("/:id/restart", controller.Restart, admin)
+	group.DELETE("/:id", controller.Delete, admin)
+	group.GET("/:id/status", controller.Status, read)
+	group.PUT("/:id/read-settings", controller.UpdateReadSettings, admin)
 
 	// Evolution API Compatibility (partially REST)
-	group.POST("/create", controller.Create)
-	group.GET("/fetchInstances", controller.List)
-	group.GET("/connect/:id", controller.Connect)
-	group.GET("/connectionState/:id", controller.Status)
-	group.DELETE("/logout/:id", controller.Logout)
-	group.DELETE("/delete/:id", controller.Delete)
-	group.PUT("/update/:id", controller.Update)
+	group.POST("/create", controller.Create, admin)
+	group.GET("/fetchInstances", controller.List, list)
+	group.GET("/connect/:id", controller.Connect, admin)
+	group.GET("/connectionState/:id", controller.Status, read)
+	group.DELETE("/logout/:id", controller.Logout, admin)
+	group.POST("/restart/:id", controller.Restart, admin)
+	group.DELETE("/delete/:id", controller.Delete, admin)
+	group.PUT("/update/:id", controller.Update, admin)
 
 }
@@ -17,7 +17,15 @@ func V1(group *echo.Group) {
 	Message(group.Group("/instance/:instance/message"))
 	Chat(group.Group("/instance/:instance/chat"))
 	Status(group.Group("/instance/:instance/status"))
+	Schedule(group.Group("/instance/:instance/schedule"))
+	Webhook(group.Group("/instance/:id/webhook"))
+	Events(group.Group("/instance/:id/events"))
+	AllEvents(group.Group("/events"))
+	Admin(group.Group("/admin"))
+	ApiKeys(group.Group("/apikeys"))
 
 	ChatEVO(group.Group("/chat"))
 	MessageEVO(group.Group("/message"))
+	SettingsEVO(group.Group("/settings"))
+	WebhookEVO(group.Group("/webhook"))
 }
@@ -3,28 +3,35 @@ package routes
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
 	"github.com/verbeux-ai/whatsmiau/repositories/instances"
 	"github.com/verbeux-ai/whatsmiau/server/controllers"
-	"github.com/verbeux-ai/whatsmiau/services"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
 )
 
 func Message(group *echo.Group) {
-	redisInstance := instances.NewRedis(services.Redis())
-	controller := controllers.NewMessages(redisInstance, whatsmiau.Get())
+	instanceRepo := instances.Get()
+	controller := controllers.NewMessages(instanceRepo, whatsmiau.Get())
+	read, send := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeSend)
 
-	group.POST("/text", controller.SendText)
-	group.POST("/audio", controller.SendAudio)
-	group.POST("/document", controller.SendDocument)
-	group.POST("/image", controller.SendImage)
-	group.POST("/video", controller.SendVideo)
+	group.POST("/text", controller.SendText, send)
+	group.POST("/audio", controller.SendAudio, send)
+	group.POST("/document", controller.SendDocument, send)
+	group.POST("/image", controller.SendImage, send)
+	group.POST("/video", controller.SendVideo, send)
+	group.POST("/sticker", controller.SendSticker, send)
+	group.GET("/jobs/:jobId", controller.GetJob, read)
 }
 
 func MessageEVO(group *echo.Group) {
-	redisInstance := instances.NewRedis(services.Redis())
-	controller := controllers.NewMessages(redisInstance, whatsmiau.Get())
+	instanceRepo := instances.Get()
+	controller := controllers.NewMessages(instanceRepo, whatsmiau.Get())
+	group.Use(middleware.Require(models.ScopeSend))
 
 	// Evolution API Compatibility (partially REST)
 	group.POST("/sendText/:instance", controller.SendText)
 	group.POST("/sendWhatsAppAudio/:instance", controller.SendAudio) // is always whatsapp 🤣
 	group.POST("/sendMedia/:instance", controller.SendMedia)
+	group.POST("/sendSticker/:instance", controller.SendSticker)
+	group.POST("/sendReaction/:instance", controller.SendReaction)
 }
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/repositories/schedules"
+	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+)
+
+func Schedule(group *echo.Group) {
+	controller := controllers.NewSchedules(schedules.Get(), instances.Get())
+	read, send := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeSend)
+
+	group.GET("", controller.List, read)
+	group.POST("", controller.Create, send)
+	group.GET("/:scheduleId", controller.Get, read)
+	group.PATCH("/:scheduleId", controller.Reschedule, send)
+	group.DELETE("/:scheduleId", controller.Delete, send)
+}
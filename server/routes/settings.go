@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+)
+
+func SettingsEVO(group *echo.Group) {
+	instanceRepo := instances.Get()
+	controller := controllers.NewSettings(instanceRepo, whatsmiau.Get())
+
+	read, admin := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeAdmin)
+
+	// Evolution API Compatibility (partially REST)
+	group.POST("/set/:instance", controller.Set, admin)
+	group.GET("/find/:instance", controller.Find, read)
+}
+
+func WebhookEVO(group *echo.Group) {
+	instanceRepo := instances.Get()
+	controller := controllers.NewSettings(instanceRepo, whatsmiau.Get())
+
+	read, admin := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeAdmin)
+
+	// Evolution API Compatibility (partially REST)
+	group.POST("/set/:instance", controller.SetWebhook, admin)
+	group.GET("/find/:instance", controller.FindWebhook, read)
+}
@@ -3,11 +3,14 @@ package routes
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
 	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
 )
 
 func Status(group *echo.Group) {
 	controller := controllers.NewStatus(whatsmiau.Get())
+	group.Use(middleware.Require(models.ScopeSend))
 
 	group.POST("/text", controller.SendText)
 	group.POST("/image", controller.SendImage)
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/verbeux-ai/whatsmiau/lib/whatsmiau"
+	"github.com/verbeux-ai/whatsmiau/models"
+	"github.com/verbeux-ai/whatsmiau/repositories/instances"
+	"github.com/verbeux-ai/whatsmiau/server/controllers"
+	"github.com/verbeux-ai/whatsmiau/server/middleware"
+)
+
+func Webhook(group *echo.Group) {
+	instanceRepo := instances.Get()
+	controller := controllers.NewWebhooks(instanceRepo, whatsmiau.Get())
+	read, admin := middleware.Require(models.ScopeRead), middleware.Require(models.ScopeAdmin)
+
+	group.GET("/deliveries", controller.ListDeliveries, read)
+	group.DELETE("/deliveries", controller.PurgeDeliveries, admin)
+	group.GET("/deliveries/:deliveryId", controller.GetDelivery, read)
+	group.DELETE("/deliveries/:deliveryId", controller.DeleteDelivery, admin)
+	group.POST("/deliveries/:deliveryId/replay", controller.ReplayDelivery, admin)
+	group.POST("/replay", controller.ReplayDeliveries, admin)
+}
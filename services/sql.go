@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/verbeux-ai/whatsmiau/env"
+	"go.uber.org/zap"
+)
+
+var sqlInstance *sql.DB
+
+// SQL returns a pool to the DIALECT_DB database, the same one holding the
+// device sessions.
+func SQL() *sql.DB {
+	if sqlInstance == nil {
+		db, err := NewSQL()
+		if err != nil {
+			zap.L().Panic("failed to connect to database", zap.Error(err))
+		}
+
+		sqlInstance = db
+	}
+
+	return sqlInstance
+}
+
+func NewSQL() (*sql.DB, error) {
+	dsn := env.Env.DBURL
+	if env.Env.DBDialect == "sqlite3" {
+		dsn = sqliteDSN(dsn)
+	}
+
+	db, err := sql.Open(env.Env.DBDialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// sqliteDSN turns on WAL, so readers don't wait for the writer, and a busy
+// timeout, so concurrent writers wait for each other instead of failing with
+// "database is locked". Values already in the DSN are kept.
+func sqliteDSN(dsn string) string {
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return dsn
+	}
+
+	if !query.Has("_journal_mode") && !query.Has("_journal") {
+		query.Set("_journal_mode", "WAL")
+	}
+	if !query.Has("_busy_timeout") && !query.Has("_timeout") {
+		query.Set("_busy_timeout", "10000")
+	}
+
+	return path + "?" + query.Encode()
+}
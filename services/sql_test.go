@@ -0,0 +1,22 @@
+package services
+
+import "testing"
+
+func TestSqliteDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"file:data.db", "file:data.db?_busy_timeout=10000&_journal_mode=WAL"},
+		{"file:data.db?_foreign_keys=on", "file:data.db?_busy_timeout=10000&_foreign_keys=on&_journal_mode=WAL"},
+		{"file:data.db?_journal=DELETE&_timeout=500", "file:data.db?_journal=DELETE&_timeout=500"},
+		{"file:data.db?_busy_timeout=1&_journal_mode=TRUNCATE", "file:data.db?_busy_timeout=1&_journal_mode=TRUNCATE"},
+		{"file:data.db?%zz", "file:data.db?%zz"},
+	}
+
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.dsn); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -18,8 +18,9 @@ func SQLStore() *sqlstore.Container {
 	defer c()
 
 	if sqlStoreInstance == nil {
-		container, err := sqlstore.New(ctx, env.Env.DBDialect, env.Env.DBURL, nil)
-		if err != nil {
+		// shares the pool of SQL, so the process keeps a single one per database
+		container := sqlstore.NewWithDB(SQL(), env.Env.DBDialect, nil)
+		if err := container.Upgrade(ctx); err != nil {
 			zap.L().Panic("failed to start sqlstore", zap.Error(err))
 		}
 